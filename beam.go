@@ -0,0 +1,103 @@
+package xrich
+
+import (
+	"math"
+	"sort"
+)
+
+//Beam is sentence found by beam search with its log-likelihood under chain
+type Beam struct {
+	Words   []string
+	LogProb float64
+	prefix  Prefix
+}
+
+//Text return words of beam joined into sentence
+func (b Beam) Text() string {
+	return joinWords(b.Words)
+}
+
+func (b Beam) extend(t transition) Beam {
+	nb := Beam{
+		LogProb: b.LogProb + math.Log(t.prob),
+		prefix:  b.prefix,
+	}
+	nb.Words = make([]string, len(b.Words), len(b.Words)+1)
+	copy(nb.Words, b.Words)
+	if t.word != NONWORD {
+		nb.Words = append(nb.Words, t.word)
+	}
+	nb.prefix.lshift()
+	nb.prefix.put(t.word)
+	return nb
+}
+
+//bestBeams return up to `k` beams with highest likelihood
+func bestBeams(bs []Beam, k int) []Beam {
+	sort.SliceStable(bs, func(i, j int) bool {
+		return bs[i].LogProb > bs[j].LogProb
+	})
+	if len(bs) > k {
+		bs = bs[:k]
+	}
+	return bs
+}
+
+//BeamSearch return up to `k` most likely sentences with max number of words `nwords` which continue text `start`.
+//If `start` is empty then sentences begin from start of phrase.
+//Sentence is finished by NONWORD, by dead end of chain or by reaching `nwords` words.
+//Return ErrEmptyChain if chain has no transitions.
+func (r *MarkovChain) BeamSearch(start string, k int, nwords int) ([]Beam, error) {
+	if r.isEmpty() {
+		return nil, ErrEmptyChain
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+
+	words, err := r.tokenize(start)
+	if err != nil {
+		return nil, err
+	}
+
+	first := Beam{Words: words, prefix: r.startPrefix()}
+	for _, w := range words {
+		first.prefix.lshift()
+		first.prefix.put(w)
+	}
+
+	var ts []transition
+	if len(first.Words) == 0 {
+		ts = r.startTransitions()
+	} else {
+		ts = r.transitions(first.prefix)
+	}
+
+	var done []Beam
+	var beams []Beam
+	for _, t := range ts {
+		beams = append(beams, first.extend(t))
+	}
+	beams = bestBeams(beams, k)
+	for i := 1; len(beams) > 0; i++ {
+		var next []Beam
+		for _, b := range beams {
+			switch {
+			case b.prefix.last() == NONWORD, i >= nwords:
+				done = append(done, b)
+			default:
+				ts := r.transitions(b.prefix)
+				if len(ts) == 0 {
+					// dead end
+					done = append(done, b)
+				}
+				for _, t := range ts {
+					next = append(next, b.extend(t))
+				}
+			}
+		}
+		beams = bestBeams(next, k)
+	}
+
+	return bestBeams(done, k), r.takeErr()
+}
@@ -0,0 +1,49 @@
+package xrich
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBeamSearch1(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	bs, err := c.BeamSearch("a", 2, 5)
+	assert.NoError(t, err)
+	if assert.Len(t, bs, 2) {
+		assert.Equal(t, "a b c", bs[0].Text())
+		assert.InDelta(t, math.Log(2.0/3), bs[0].LogProb, 1e-9)
+		assert.Equal(t, "a b d", bs[1].Text())
+		assert.InDelta(t, math.Log(1.0/3), bs[1].LogProb, 1e-9)
+	}
+}
+
+func TestBeamSearch2(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	bs, err := c.BeamSearch("", 1, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, bs, 1) {
+		assert.Equal(t, []string{"a", "b"}, bs[0].Words)
+		assert.InDelta(t, 0, bs[0].LogProb, 1e-9)
+	}
+}
+
+func TestBeamSearch3(t *testing.T) {
+	ss := []string{"a b c"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	bs, err := c.BeamSearch("x", 3, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, bs)
+}
+
+func TestBeamSearchEmpty(t *testing.T) {
+	c := NewMarkovChain()
+	_, err := c.BeamSearch("a", 3, 5)
+	assert.Equal(t, ErrEmptyChain, err)
+}
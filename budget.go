@@ -0,0 +1,253 @@
+package xrich
+
+import (
+	"container/heap"
+	"unsafe"
+)
+
+//EvictionPolicy choose prefixes which are evicted from chain exceeding memory budget
+type EvictionPolicy int
+
+const (
+	//EvictLRU evict least recently used prefixes
+	EvictLRU EvictionPolicy = iota
+	//EvictLFU evict least frequently used prefixes, least recently used first among equally used
+	EvictLFU
+)
+
+//MemoryBudget limit size of chain, zero limit is disabled
+type MemoryBudget struct {
+	MaxBytes    int            // approximate size of chain as reported by Stats.Bytes
+	MaxPrefixes int            // number of prefixes
+	Eviction    EvictionPolicy // which prefixes are evicted
+}
+
+//budgetHeadroom is part of limit which chain is reduced to by eviction, so eviction does not run on every new prefix
+const budgetHeadroom = 0.9
+
+//prefixUsage is size and usage of prefix tracked for eviction
+type prefixUsage struct {
+	prefix *Prefix // key of chain, so usage does not copy prefix
+	bytes  int
+	uses   int    // number of learned and generated transitions
+	last   uint64 // clock of last use
+	pos    int    // position in queue of eviction, -1 if prefix is not in queue
+}
+
+//usageOverhead is approximate size of usage of prefix in memory budget which is counted in size of chain
+var usageOverhead = int(unsafe.Sizeof(Prefix{})) + 2*int(unsafe.Sizeof(&prefixUsage{})) + int(unsafe.Sizeof(prefixUsage{}))
+
+//usageQueue is heap of usages of prefixes with prefix which is evicted first on top
+type usageQueue struct {
+	items []*prefixUsage
+	lfu   bool
+}
+
+func (r *usageQueue) Len() int {
+	return len(r.items)
+}
+
+func (r *usageQueue) Less(i, j int) bool {
+	ui, uj := r.items[i], r.items[j]
+	if r.lfu && ui.uses != uj.uses {
+		return ui.uses < uj.uses
+	}
+	return ui.last < uj.last
+}
+
+func (r *usageQueue) Swap(i, j int) {
+	r.items[i], r.items[j] = r.items[j], r.items[i]
+	r.items[i].pos = i
+	r.items[j].pos = j
+}
+
+func (r *usageQueue) Push(x interface{}) {
+	u := x.(*prefixUsage)
+	u.pos = len(r.items)
+	r.items = append(r.items, u)
+}
+
+func (r *usageQueue) Pop() interface{} {
+	n := len(r.items) - 1
+	u := r.items[n]
+	r.items[n] = nil
+	r.items = r.items[:n]
+	u.pos = -1
+	return u
+}
+
+//memoryBudget track usage of prefixes of chain with budget
+type memoryBudget struct {
+	MemoryBudget
+	usage map[Prefix]*prefixUsage
+	queue usageQueue
+	bytes int
+	clock uint64
+}
+
+//SetMemoryBudget limit size of chain by budget `b`. Prefixes are used when they are learned or generated from,
+//prefixes are evicted by policy of budget when chain exceeds limit, start of phrase is never evicted.
+//Usage of prefixes is counted in size of chain. Budget without limits disables it.
+func (r *MarkovChain) SetMemoryBudget(b MemoryBudget) error {
+	if b.MaxBytes <= 0 && b.MaxPrefixes <= 0 {
+		r.budget = nil
+		return nil
+	}
+	mb := &memoryBudget{MemoryBudget: b, usage: make(map[Prefix]*prefixUsage, len(r.keys))}
+	mb.queue = usageQueue{items: make([]*prefixUsage, 0, len(r.keys)), lfu: b.Eviction == EvictLFU}
+	for _, p := range r.keys {
+		sx, err := r.store.Get(*p)
+		if err != nil {
+			return &StoreError{Op: "get", Err: err}
+		}
+		mb.clock++
+		u := &prefixUsage{prefix: p, bytes: approxBytes(*p, sx) + usageOverhead, uses: len(sx), last: mb.clock}
+		mb.usage[*p] = u
+		mb.bytes += u.bytes
+		heap.Push(&mb.queue, u)
+	}
+	r.budget = mb
+	return r.evict()
+}
+
+//learn record use of prefix `p` of keys of chain by learning of suffixes `sx`
+func (r *memoryBudget) learn(p *Prefix, sx []Suffix) {
+	if r == nil {
+		return
+	}
+	u, ok := r.usage[*p]
+	if !ok {
+		u = &prefixUsage{prefix: p, bytes: prefixBytes(*p) + usageOverhead}
+		r.usage[*p] = u
+		r.bytes += u.bytes
+		heap.Push(&r.queue, u)
+	}
+	n := suffixBytes(sx)
+	u.bytes += n
+	r.bytes += n
+	u.uses += len(sx)
+	r.use(u)
+}
+
+//touch record use of prefix `p` by generation
+func (r *memoryBudget) touch(p Prefix) {
+	if r == nil {
+		return
+	}
+	if u, ok := r.usage[p]; ok {
+		u.uses++
+		r.use(u)
+	}
+}
+
+//use update clock of last use of usage `u` and its position in queue of eviction
+func (r *memoryBudget) use(u *prefixUsage) {
+	r.clock++
+	u.last = r.clock
+	if u.pos >= 0 {
+		heap.Fix(&r.queue, u.pos)
+	}
+}
+
+//resize update size of prefix `p` whose suffixes are replaced by `sx`
+func (r *memoryBudget) resize(p Prefix, sx []Suffix) {
+	if r == nil {
+		return
+	}
+	u, ok := r.usage[p]
+	if !ok {
+		return
+	}
+	r.bytes -= u.bytes
+	if len(sx) == 0 {
+		delete(r.usage, p)
+		if u.pos >= 0 {
+			heap.Remove(&r.queue, u.pos)
+		}
+		return
+	}
+	u.bytes = approxBytes(p, sx) + usageOverhead
+	r.bytes += u.bytes
+}
+
+//exceeded return true if size of chain is over limits multiplied by `part`
+func (r *memoryBudget) exceeded(part float64) bool {
+	return r.MaxBytes > 0 && float64(r.bytes) > part*float64(r.MaxBytes) ||
+		r.MaxPrefixes > 0 && float64(len(r.usage)) > part*float64(r.MaxPrefixes)
+}
+
+//evict remove prefixes by eviction policy if chain exceeds memory budget until it fits into budget with headroom.
+//Prefixes are taken from queue of eviction, so they are not sorted on every eviction.
+func (r *MarkovChain) evict() error {
+	b := r.budget
+	if b == nil || !b.exceeded(1) {
+		return nil
+	}
+	evicted := make(map[Prefix]bool)
+	var kept []*prefixUsage
+	var err error
+	for b.exceeded(budgetHeadroom) && b.queue.Len() > 0 {
+		u := heap.Pop(&b.queue).(*prefixUsage)
+		p := *u.prefix
+		if p.isStart() {
+			kept = append(kept, u)
+			continue
+		}
+		if err = r.store.Set(p, nil); err != nil {
+			kept = append(kept, u)
+			err = &StoreError{Op: "set", Err: err}
+			break
+		}
+		b.resize(p, nil)
+		evicted[p] = true
+	}
+	for _, u := range kept {
+		heap.Push(&b.queue, u)
+	}
+	r.removePrefixes(evicted)
+	r.logger.Debugw("prefixes are evicted", "func", "evict", "evicted", len(evicted), "prefixes", len(r.keys))
+	return err
+}
+
+//removePrefixes remove prefixes `px` which are removed from store from keys and index of chain
+func (r *MarkovChain) removePrefixes(px map[Prefix]bool) {
+	if len(px) == 0 {
+		return
+	}
+	keys := r.keys[:0]
+	for _, p := range r.keys {
+		if !px[*p] {
+			keys = append(keys, p)
+		}
+	}
+	for i := len(keys); i < len(r.keys); i++ {
+		r.keys[i] = nil
+	}
+	r.keys = keys
+	r.lower = nil
+
+	// only entries of words of removed prefixes are changed in index
+	changed := make(map[string]bool)
+	for p := range px {
+		for _, key := range r.indexKeys(&p) {
+			changed[key] = true
+		}
+	}
+	for key := range changed {
+		entries := r.index[key]
+		kept := entries[:0]
+		for _, p := range entries {
+			if !px[*p] {
+				kept = append(kept, p)
+			}
+		}
+		for i := len(kept); i < len(entries); i++ {
+			entries[i] = nil
+		}
+		if len(kept) == 0 {
+			delete(r.index, key)
+			continue
+		}
+		r.index[key] = kept
+	}
+}
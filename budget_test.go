@@ -0,0 +1,89 @@
+package xrich
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBudget1(t *testing.T) {
+	c := NewMarkovChain()
+	assert.NoError(t, c.SetMemoryBudget(MemoryBudget{MaxPrefixes: 10}))
+	assert.NoError(t, c.Build(benchTextBlocks(100, 50)))
+	assert.True(t, len(c.keys) <= 10)
+	assert.Equal(t, c.store.Len(), len(c.keys))
+	assert.True(t, c.keys[0].isStart())
+	st, err := c.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, st.Bytes, c.budget.bytes)
+	assert.Equal(t, len(c.budget.usage), c.budget.queue.Len())
+	for _, px := range c.index {
+		for _, p := range px {
+			sx, err := c.store.Get(*p)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, sx)
+		}
+	}
+	index := c.index
+	c.SetNormalizer(c.norm)
+	assert.Equal(t, c.index, index)
+
+	assert.NoError(t, c.SetMemoryBudget(MemoryBudget{MaxBytes: st.Bytes / 2}))
+	st2, err := c.Stats()
+	assert.NoError(t, err)
+	assert.True(t, st2.Bytes <= st.Bytes/2)
+	assert.Equal(t, st2.Bytes, c.budget.bytes)
+}
+
+func TestMemoryBudget2(t *testing.T) {
+	ss := []string{"a b", "c d", "e f"}
+	p := Prefix{words: [MAXNPREF]string{"\n", "a"}, n: 2}
+	for _, eviction := range []EvictionPolicy{EvictLRU, EvictLFU} {
+		c := NewMarkovChain()
+		assert.NoError(t, c.Build(ss))
+		n := len(c.keys)
+		assert.NoError(t, c.SetMemoryBudget(MemoryBudget{MaxPrefixes: n, Eviction: eviction}))
+		// prefix used by generation is kept by both policies
+		c.findSuffix(p)
+		c.findSuffix(p)
+		assert.NoError(t, c.Build([]string{"g h"}))
+		sx, err := c.store.Get(p)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, sx)
+		assert.True(t, len(c.keys) <= n)
+		assert.Equal(t, c.store.Len(), len(c.keys))
+	}
+}
+
+func TestMemoryBudget3(t *testing.T) {
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(benchTextBlocks(20, 10)))
+	n := len(c.keys)
+	assert.NoError(t, c.SetMemoryBudget(MemoryBudget{MaxPrefixes: n}))
+	for _, p := range c.keys[n/2:] {
+		c.findSuffix(*p)
+	}
+	// least recently used prefixes are evicted first
+	var old []Prefix
+	for p := range c.budget.usage {
+		if !p.isStart() {
+			old = append(old, p)
+		}
+	}
+	sort.Slice(old, func(i, j int) bool { return c.budget.usage[old[i]].last < c.budget.usage[old[j]].last })
+	assert.NoError(t, c.Build([]string{"x y"}))
+	evicted := 0
+	for _, p := range old {
+		if _, ok := c.budget.usage[p]; ok {
+			break
+		}
+		evicted++
+	}
+	assert.True(t, evicted > 0)
+	for _, p := range old[evicted:] {
+		assert.Contains(t, c.budget.usage, p)
+	}
+	assert.Equal(t, len(c.budget.usage), c.budget.queue.Len())
+	assert.Equal(t, c.store.Len(), len(c.keys))
+}
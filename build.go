@@ -0,0 +1,195 @@
+package xrich
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+//shardBounds split `n` items into `k` contiguous shards and return bounds of shards, shard i is [bounds[i], bounds[i+1])
+func shardBounds(n int, k int) []int {
+	bounds := make([]int, k+1)
+	for i := range bounds {
+		bounds[i] = i * n / k
+	}
+	return bounds
+}
+
+//newPartial return empty chain with same order, kind of tokens and settings of building as chain
+//to build part of chain concurrently
+func (r *MarkovChain) newPartial() MarkovChain {
+	c := NewMarkovChain()
+	c.order = r.order
+	c.chars = r.chars
+	c.provenance = r.provenance
+	c.compound = r.compound
+	c.typography = r.typography
+	c.skipPunct = r.skipPunct
+	c.filter = r.filter
+	return c
+}
+
+//BuildParallel build states transition table from text blocks like `Build` using `workers` goroutines
+//or one goroutine per CPU if `workers` is zero. Text blocks are split into shards which are tokenized and counted
+//into partial chains concurrently, then partial chains are merged in order, so result is same as of `Build`.
+func (r *MarkovChain) BuildParallel(textBlocks []string, workers int) error {
+	return r.buildParallel(textBlocks, nil, workers)
+}
+
+//buildParallel add text blocks `textBlocks` written at unix times `dates` to chain using `workers` goroutines,
+//blocks are undated if `dates` is nil
+func (r *MarkovChain) buildParallel(textBlocks []string, dates []int64, workers int) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(textBlocks) {
+		workers = len(textBlocks)
+	}
+	if workers <= 1 {
+		return r.build(textBlocks, dates)
+	}
+	r.policy.init(r)
+
+	tokens := make([][]string, len(textBlocks))
+	values := make([][]placeholderValue, len(textBlocks))
+	kept := make([]bool, len(textBlocks))
+	errs := make([]error, len(textBlocks))
+	var wg sync.WaitGroup
+	bounds := shardBounds(len(textBlocks), workers)
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func(lo int, hi int) {
+			defer wg.Done()
+			for i := lo; i < hi; i++ {
+				tokens[i], values[i], kept[i], errs[i] = r.tokenizeBlock(textBlocks[i])
+			}
+		}(bounds[k], bounds[k+1])
+	}
+	wg.Wait()
+
+	// like `Build` add only text blocks before first failed one,
+	// values of placeholders are remembered in order of text blocks
+	var scanErr error
+	for i, err := range errs {
+		r.placeholders.remember(values[i])
+		if err != nil {
+			r.logger.Errorw("error scanning text block", "func", "BuildParallel", "block", i, "error", err)
+			scanErr = &ScanError{Block: i, Err: errors.Unwrap(err)}
+			tokens = tokens[:i]
+			break
+		}
+	}
+
+	// context at start of shard depends on end of previous text block
+	bounds = shardBounds(len(tokens), workers)
+	ctxs := make([]Context, workers)
+	ctx := Context{prefix: r.startPrefix()}
+	for k := 0; k < workers; k++ {
+		ctxs[k] = ctx
+		if k+1 < workers {
+			for i := bounds[k]; i < bounds[k+1]; i++ {
+				if kept[i] {
+					r.skipBlock(&ctx, tokens[i])
+				}
+			}
+		}
+	}
+
+	partials := make([]MarkovChain, workers)
+	perrs := make([]error, workers)
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			c := r.newPartial()
+			ctx := ctxs[k]
+			for j, words := range tokens[bounds[k]:bounds[k+1]] {
+				if !kept[bounds[k]+j] {
+					// index of dropped text block is kept for sources of next ones
+					c.nblocks++
+					continue
+				}
+				if dates != nil {
+					ctx.date = dates[bounds[k]+j]
+				}
+				if err := c.addBlock(&ctx, words, bounds[k]+j); err != nil {
+					perrs[k] = err
+					return
+				}
+			}
+			partials[k] = c
+		}(k)
+	}
+	wg.Wait()
+
+	for k := range partials {
+		if perrs[k] != nil {
+			return perrs[k]
+		}
+		if err := r.Merge(&partials[k]); err != nil {
+			return err
+		}
+	}
+	r.logger.Debugw("chain is built", "func", "BuildParallel", "blocks", len(tokens), "prefixes", len(r.keys), "workers", workers)
+	return scanErr
+}
+
+//Merge append transitions of chain `other` to chain as if text blocks of `other` were built after text blocks of chain
+//by separate call of `Build`. Sources of words of `other` are shifted by number of text blocks of chain.
+//Return ErrIncompatible if chains have different order, kind of tokens or skipping of punctuation.
+func (r *MarkovChain) Merge(other *MarkovChain) error {
+	if other.order != r.order || other.chars != r.chars || other.skipPunct != r.skipPunct {
+		return ErrIncompatible
+	}
+	offset := int32(r.nblocks)
+	ba, bulk := r.store.(bulkAppender)
+	for _, p := range other.keys {
+		sx, err := other.store.Get(*p)
+		if err != nil {
+			return &StoreError{Op: "get", Err: err}
+		}
+		if offset != 0 && other.provenance {
+			sx = append([]Suffix(nil), sx...)
+			for i := range sx {
+				if sx[i].src != NOSOURCE {
+					sx[i].src += offset
+				}
+			}
+		}
+		if !bulk {
+			for _, s := range sx {
+				if err := r.addWord(*p, s); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		r.lower = nil
+		added, err := ba.appendAll(*p, sx)
+		if err != nil {
+			return &StoreError{Op: "append", Err: err}
+		}
+		np := p
+		if added {
+			np = &Prefix{}
+			*np = *p
+			r.keys = append(r.keys, np)
+			r.indexPrefix(np)
+		}
+		r.budget.learn(np, sx)
+		if err := r.evict(); err != nil {
+			return err
+		}
+	}
+	r.nblocks += other.nblocks
+	r.placeholders.merge(other.placeholders)
+	if other.latest > r.latest {
+		r.latest = other.latest
+	}
+	return nil
+}
+
+//bulkAppender is implemented by stores which add many suffixes of prefix at once
+type bulkAppender interface {
+	appendAll(p Prefix, sx []Suffix) (bool, error)
+}
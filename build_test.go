@@ -0,0 +1,108 @@
+package xrich
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//assertSameChain check that chains have same transitions and keys
+func assertSameChain(t *testing.T, expected *MarkovChain, actual *MarkovChain) {
+	assert.Equal(t, expected.store.(*MapStore).statetab, actual.store.(*MapStore).statetab)
+	assert.Equal(t, expected.keys, actual.keys)
+	assert.Equal(t, expected.index, actual.index)
+	assert.Equal(t, expected.nblocks, actual.nblocks)
+}
+
+func TestBuildParallel1(t *testing.T) {
+	ss := []string{"a, . b c b . .", "b", "c d", "x, y: z", "q", "a b c", "d ! e"}
+	for _, workers := range []int{0, 2, 3, 7, 10} {
+		c := NewMarkovChain()
+		c.SetProvenance(true)
+		assert.NoError(t, c.Build(ss))
+		pc := NewMarkovChain()
+		pc.SetProvenance(true)
+		assert.NoError(t, pc.BuildParallel(ss, workers))
+		assertSameChain(t, &c, &pc)
+	}
+}
+
+func TestBuildParallel2(t *testing.T) {
+	ss := []string{"anna", "bob", "ann"}
+	c, err := NewCharMarkovChain(3)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Build(ss))
+	pc, err := NewCharMarkovChain(3)
+	assert.NoError(t, err)
+	assert.NoError(t, pc.BuildParallel(ss, 2))
+	assertSameChain(t, &c, &pc)
+}
+
+func TestBuildParallel3(t *testing.T) {
+	ss := []string{"a b", "c d", "c " + strings.Repeat("d", bufio.MaxScanTokenSize), "e f"}
+	c := NewMarkovChain()
+	err := c.Build(ss)
+	pc := NewMarkovChain()
+	perr := pc.BuildParallel(ss, 4)
+	assert.Equal(t, err, perr)
+	assertSameChain(t, &c, &pc)
+}
+
+func TestBuildParallel4(t *testing.T) {
+	ss := []string{"a, b - - c d", "e f, g", "a b", "x; y, z .", "c, d e"}
+	for _, workers := range []int{2, 3, 5} {
+		c := NewMarkovChain()
+		c.SetSkipPunctuation(true)
+		assert.NoError(t, c.Build(ss))
+		pc := NewMarkovChain()
+		pc.SetSkipPunctuation(true)
+		assert.NoError(t, pc.BuildParallel(ss, workers))
+		assertSameChain(t, &c, &pc)
+	}
+
+	// chains with different skipping of punctuation can not be merged
+	c := NewMarkovChain()
+	c.SetSkipPunctuation(true)
+	other := NewMarkovChain()
+	assert.Equal(t, ErrIncompatible, c.Merge(&other))
+}
+
+func TestMerge1(t *testing.T) {
+	c := NewMarkovChain()
+	c.SetProvenance(true)
+	assert.NoError(t, c.Build([]string{"a b c"}))
+	assert.NoError(t, c.Build([]string{"b c d", "x"}))
+
+	c1 := NewMarkovChain()
+	c1.SetProvenance(true)
+	assert.NoError(t, c1.Build([]string{"a b c"}))
+	c2 := NewMarkovChain()
+	c2.SetProvenance(true)
+	assert.NoError(t, c2.Build([]string{"b c d", "x"}))
+	assert.NoError(t, c1.Merge(&c2))
+	assertSameChain(t, &c, &c1)
+
+	cc, err := NewCharMarkovChain(2)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrIncompatible, c1.Merge(&cc))
+}
+
+func BenchmarkBuild(b *testing.B) {
+	ss := benchTextBlocks(20000, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := NewMarkovChain()
+		c.Build(ss)
+	}
+}
+
+func BenchmarkBuildParallel(b *testing.B) {
+	ss := benchTextBlocks(20000, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := NewMarkovChain()
+		c.BuildParallel(ss, 0)
+	}
+}
@@ -2,28 +2,31 @@ package xrich
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
-
-	"go.uber.org/zap"
 )
 
 const (
 	// NPREF is Prefix length
 	NPREF = 2
+	// MAXNPREF is max Prefix length of chain with custom order
+	MAXNPREF = 4
 	// NONWORD is empty word
 	NONWORD = "\n"
 	// MAXGEN is max number of generated words
 	MAXGEN = 50
 	// SEP is separator between phrases
 	SEP = "."
+	// NOSOURCE is source of words which are not taken from text blocks
+	NOSOURCE = -1
 )
 
 var reClearTrash = regexp.MustCompile(`[^A-zА-я\p{P}\s]`)
-var reIsWord = regexp.MustCompile(`.*[A-zА-я].*`)
 var reMultiPunct = regexp.MustCompile(`(\p{P}\s){2,}`)
 
 func clearString(s string) string {
@@ -35,32 +38,7 @@ func clearString(s string) string {
 // never return an empty string. The definition of space is set by
 // unicode.IsSpace. The definition of punct is set by unicode.IsPunct.
 func ScanWordsAndPunct(data []byte, atEOF bool) (advance int, token []byte, err error) {
-	// Skip leading spaces.
-	start := 0
-	for width := 0; start < len(data); start += width {
-		var r rune
-		r, width = utf8.DecodeRune(data[start:])
-		if !unicode.IsSpace(r) {
-			break
-		}
-	}
-	// Scan until space, marking end of word.
-	for width, i := 0, start; i < len(data); i += width {
-		var r rune
-		r, width = utf8.DecodeRune(data[i:])
-		if unicode.IsPunct(r) && i != start {
-			return i, data[start:i], nil
-		}
-		if unicode.IsSpace(r) {
-			return i + width, data[start:i], nil
-		}
-	}
-	// If we're at EOF, we have a final, non-empty, non-terminated word. Return it.
-	if atEOF && len(data) > start {
-		return len(data), data[start:], nil
-	}
-	// Request more data.
-	return start, nil, nil
+	return scanTokens(data, atEOF, scanPunct)
 }
 
 // ScanOnlyWords is a split function for a Scanner that returns each
@@ -68,20 +46,73 @@ func ScanWordsAndPunct(data []byte, atEOF bool) (advance int, token []byte, err
 // never return an empty string. The definition of space is set by
 // unicode.IsSpace. The definition of punct is set by unicode.IsPunct.
 func ScanOnlyWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	return scanTokens(data, atEOF, 0)
+}
+
+// ScanCompoundWordsAndPunct is a split function like ScanWordsAndPunct, but hyphens and apostrophes
+// between letters or digits are kept inside of word, so "кто-то" and "don't" are single tokens.
+func ScanCompoundWordsAndPunct(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	return scanTokens(data, atEOF, scanPunct|scanCompound)
+}
+
+// ScanCompoundOnlyWords is a split function like ScanOnlyWords, but hyphens and apostrophes
+// between letters or digits are kept inside of word.
+func ScanCompoundOnlyWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	return scanTokens(data, atEOF, scanCompound)
+}
+
+//scanMode choose tokens produced by `scanTokens`
+type scanMode int
+
+const (
+	// scanPunct return punctuation tokens instead of skipping punctuation
+	scanPunct scanMode = 1 << iota
+	// scanCompound keep hyphens and apostrophes inside of words
+	scanCompound
+	// scanTypography return runs of terminators and dashes as single tokens and end punctuation token before word
+	scanTypography
+)
+
+//scanTokens split `data` into words and punctuation or only into words by mode `mode`
+func scanTokens(data []byte, atEOF bool, mode scanMode) (advance int, token []byte, err error) {
+	punct, compound := mode&scanPunct != 0, mode&scanCompound != 0
 	// Skip leading spaces.
 	start := 0
 	for width := 0; start < len(data); start += width {
 		var r rune
 		r, width = utf8.DecodeRune(data[start:])
-		if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+		if !unicode.IsSpace(r) && (punct || !unicode.IsPunct(r)) {
 			break
 		}
 	}
+	if punct && mode&scanTypography != 0 && start < len(data) {
+		if r, _ := utf8.DecodeRune(data[start:]); unicode.IsPunct(r) {
+			return scanPunctRun(data, start, atEOF)
+		}
+	}
 	// Scan until space, marking end of word.
 	for width, i := 0, start; i < len(data); i += width {
 		var r rune
 		r, width = utf8.DecodeRune(data[i:])
-		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+		if compound && i != start && isJoiner(r) {
+			joined, more := joinsWord(data, i, width, atEOF)
+			if more {
+				// Request more data to see rune after joiner.
+				return start, nil, nil
+			}
+			if joined {
+				continue
+			}
+		}
+		if unicode.IsPunct(r) {
+			if !punct {
+				return i + width, data[start:i], nil
+			}
+			if i != start {
+				return i, data[start:i], nil
+			}
+		}
+		if unicode.IsSpace(r) {
 			return i + width, data[start:i], nil
 		}
 	}
@@ -93,235 +124,943 @@ func ScanOnlyWords(data []byte, atEOF bool) (advance int, token []byte, err erro
 	return start, nil, nil
 }
 
-//Prefix is key for map {prefix:suffix}
+//isJoiner return true if rune `r` can join parts of compound word
+func isJoiner(r rune) bool {
+	switch r {
+	case '-', '\'', '‐', '’', 'ʼ':
+		return true
+	}
+	return false
+}
+
+//joinsWord return true if joiner of width `width` at position `i` of `data` is between letters or digits.
+//Return true for `more` if rune after joiner is not read yet.
+func joinsWord(data []byte, i int, width int, atEOF bool) (joined bool, more bool) {
+	prev, _ := utf8.DecodeLastRune(data[:i])
+	if !isWordRune(prev) {
+		return false, false
+	}
+	if i+width >= len(data) {
+		return false, !atEOF
+	}
+	next, _ := utf8.DecodeRune(data[i+width:])
+	return isWordRune(next), false
+}
+
+//isWordRune return true if rune `r` is letter or digit
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+//Prefix is key for map {prefix:suffix}.
+//Words are kept inline for any order up to MAXNPREF, so prefix is comparable key of map without allocation
+//and one type serves chains, stores and policies of all orders. For order 2 it costs memory: map of prefixes is
+//about 1.5 times larger than map keyed by two words (see BenchmarkPrefixKeyArray2 and BenchmarkPrefixKeyPrefix)
+//and built chain takes about 1.4 times more memory. Compiled chain keeps prefixes as ids of words, so it should
+//be served when memory matters.
 type Prefix struct {
-	words [NPREF]string
+	words [MAXNPREF]string
+	n     int
 }
 
 //Suffix is value for map {prefix:suffix}
 type Suffix struct {
-	sol  bool //start-of-line
+	sol  bool  //start-of-line
+	src  int32 //index of source text block or NOSOURCE
 	word string
+	date int64 //unix time of text block or zero if it is unknown
 }
 
-func newPrefix(logger *zap.SugaredLogger, words ...string) *Prefix {
-	if len(words) != NPREF {
-		logger.Fatalw("tried intialize Prefex with invalid len")
+//newPrefix return prefix of words `words` or ErrInvalidOrder if number of words is out of range [1, MAXNPREF]
+func newPrefix(words ...string) (*Prefix, error) {
+	if len(words) < 1 || len(words) > MAXNPREF {
+		return nil, ErrInvalidOrder
 	}
-	prefix := Prefix{}
-	for i := 0; i < NPREF; i++ {
+	prefix := Prefix{n: len(words)}
+	for i := 0; i < prefix.n; i++ {
 		prefix.words[i] = words[i]
 	}
-	return &prefix
+	return &prefix, nil
 }
 
 func (r *Prefix) fill(word string) {
-	for i := 0; i < NPREF; i++ {
+	for i := 0; i < r.n; i++ {
 		r.words[i] = word
 	}
 }
 
 func (r *Prefix) lshift() {
-	for i := 0; i < NPREF-1; i++ {
+	for i := 0; i < r.n-1; i++ {
 		r.words[i] = r.words[i+1]
 	}
 }
 
 func (r *Prefix) put(word string) {
-	r.words[NPREF-1] = word
+	r.words[r.n-1] = word
+}
+
+func (r *Prefix) last() string {
+	return r.words[r.n-1]
+}
+
+//isStart return true if prefix consist of NONWORDs only, i.e. it is start of phrase
+func (r *Prefix) isStart() bool {
+	for i := 0; i < r.n; i++ {
+		if r.words[i] != NONWORD {
+			return false
+		}
+	}
+	return true
 }
 
 //Context keep current state
 type Context struct {
 	prefix      Prefix
+	words       Prefix // last words without punctuation if punctuation is skipped
 	preLastWord string
+	src         int32
+	date        int64
+	prob        float64 // probability of last transition
 }
 
 //MarkovChain are main structure that hold states transitions
 type MarkovChain struct {
-	statetab map[Prefix][]Suffix
-	policy   GeneratePolicy
-	keys     []*Prefix
-	logger   *zap.SugaredLogger
+	store        StateStore
+	policy       GeneratePolicy
+	keys         []*Prefix
+	index        map[string][]*Prefix
+	norm         Normalizer
+	lower        *lowerOrder
+	order        int
+	chars        bool
+	provenance   bool
+	compound     bool
+	typography   bool
+	skipPunct    bool
+	nblocks      int
+	latest       int64          // unix time of latest dated text block
+	halfLife     time.Duration  // age of transition which halves its weight, transitions are not weighted if zero
+	budget       *memoryBudget  // nil if size of chain is not limited
+	filter       *ContentFilter // nil if content is not filtered
+	placeholders *placeholders  // nil if values of text blocks are not replaced by placeholders
+	err          error          // first error of store since last public call
+	logger       Logger
 }
 
-//NewMarkovChain create new object of MarkovChain
-func NewMarkovChain(logger *zap.Logger) MarkovChain {
-	sugaredLogger := logger.Sugar()
+//NewMarkovChain create new object of MarkovChain. Chain does not log anything until logger is set by `SetLogger`.
+func NewMarkovChain() MarkovChain {
 	return MarkovChain{
-		statetab: make(map[Prefix][]Suffix),
-		policy:   new(RandomGeneratePolicy),
-		logger:   sugaredLogger,
+		store:  NewMapStore(),
+		policy: new(RandomGeneratePolicy),
+		index:  make(map[string][]*Prefix),
+		norm:   CaseNormalizer{},
+		order:  NPREF,
+		logger: nopLogger{},
 	}
 }
 
+//NewCharMarkovChain create new object of MarkovChain which is built from characters instead of words.
+//Prefix length is `order`, every text block is started and ended by NONWORD marker.
+//Return ErrInvalidOrder if order is out of range [1, MAXNPREF].
+func NewCharMarkovChain(order int) (MarkovChain, error) {
+	if order < 1 || order > MAXNPREF {
+		return MarkovChain{}, ErrInvalidOrder
+	}
+	c := NewMarkovChain()
+	c.order = order
+	c.chars = true
+	return c, nil
+}
+
+//SetOrder set prefix length of chain to `order`, it is NPREF by default. It must be called before `Build`.
+//Return ErrInvalidOrder if order is out of range [1, MAXNPREF] and ErrIncompatible if chain is not empty.
+func (r *MarkovChain) SetOrder(order int) error {
+	if order < 1 || order > MAXNPREF {
+		return ErrInvalidOrder
+	}
+	if !r.isEmpty() {
+		return ErrIncompatible
+	}
+	r.order = order
+	return nil
+}
+
+//SetLogger set logger of chain. Nil logger disable logging.
+func (r *MarkovChain) SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	r.logger = l
+}
+
 //SetGeneratePolicy allow change choice policy of elements in key transitions
 func (r *MarkovChain) SetGeneratePolicy(p GeneratePolicy) {
 	r.policy = p
 }
 
+//SetStateStore replace states transitions table of chain by store `s`, e.g. opened `FileStore` with chain built earlier.
+//Prefixes of store are loaded into memory in order of addition, chain keeps this order and word index itself,
+//so store only finds suffixes of prefix, suffixes are read from store on demand.
+//If half-life is set, all suffixes are read once to find latest date of chain.
+func (r *MarkovChain) SetStateStore(s StateStore) error {
+	var keys []*Prefix
+	err := s.Range(func(p Prefix) bool {
+		keys = append(keys, &p)
+		return true
+	})
+	if err != nil {
+		return &StoreError{Op: "range", Err: err}
+	}
+	r.store = s
+	r.keys = keys
+	r.lower = nil
+	r.SetNormalizer(r.norm)
+	if r.halfLife > 0 {
+		if err := r.findLatest(); err != nil {
+			return err
+		}
+	}
+	if r.budget != nil {
+		return r.SetMemoryBudget(r.budget.MemoryBudget)
+	}
+	return nil
+}
+
+//suffixes return suffixes of prefix `p` or nil if prefix is unknown.
+//Error of store is kept until it is taken by `takeErr`.
+func (r *MarkovChain) suffixes(p Prefix) []Suffix {
+	sx, err := r.store.Get(p)
+	if err != nil {
+		r.logger.Errorw("error reading state store", "func", "suffixes", "error", err)
+		if r.err == nil {
+			r.err = &StoreError{Op: "get", Err: err}
+		}
+		return nil
+	}
+	return sx
+}
+
+//takeErr return and clear error of store which occurred since last call
+func (r *MarkovChain) takeErr() error {
+	err := r.err
+	r.err = nil
+	return err
+}
+
+//isEmpty return true if chain has no transitions
+func (r *MarkovChain) isEmpty() bool {
+	return r.store.Len() == 0
+}
+
+//SetProvenance enable recording of source text blocks of transitions by `Build`.
+//Source of text block is its index counted over all calls of `Build`.
+func (r *MarkovChain) SetProvenance(enabled bool) {
+	r.provenance = enabled
+}
+
+//SetCompoundWords keep hyphens and apostrophes between letters inside of words, so "кто-то", "из-за" and "don't"
+//are single tokens instead of three ones. It must be set before `Build` and match setting of chain which was stored.
+func (r *MarkovChain) SetCompoundWords(enabled bool) {
+	r.compound = enabled
+}
+
+//SetSkipPunctuation make punctuation transparent for prefixes: every transition is also added to prefix
+//of last words without punctuation between them, so "a , b c" and "a b c" share prefix [a b] for any order
+//and words of messages matched without punctuation find same prefixes. It replaces built-in skip of single
+//punctuation token between words for order 2. It must be set before `Build`.
+func (r *MarkovChain) SetSkipPunctuation(enabled bool) {
+	r.skipPunct = enabled
+}
+
+//SetNormalizer allow change how words of message are matched with words of chain
+func (r *MarkovChain) SetNormalizer(n Normalizer) {
+	r.norm = n
+	if l, ok := r.store.(prefixLister); ok {
+		l.reindex(r)
+		return
+	}
+	r.index = make(map[string][]*Prefix)
+	for _, p := range r.keys {
+		r.indexPrefix(p)
+	}
+}
+
+//isWord return true if `s` contains letter of range A-z or А-я, so compound words and placeholders are words
+//while hyphens, apostrophes and other punctuation are not
 func isWord(s string) bool {
-	return reIsWord.MatchString(s)
+	for _, c := range s {
+		if c >= 'A' && c <= 'z' || c >= 'А' && c <= 'я' {
+			return true
+		}
+	}
+	return false
+}
+
+//startPrefix return prefix which starts phrase
+func (r *MarkovChain) startPrefix() Prefix {
+	prefix := Prefix{n: r.order}
+	prefix.fill(NONWORD)
+	return prefix
+}
+
+func (r *MarkovChain) stepBuild(ctx *Context, word string, sol bool) error {
+	px, n := r.advance(ctx, word)
+	for _, p := range px[:n] {
+		if err := r.addWord(p, Suffix{sol, ctx.src, word, ctx.date}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *MarkovChain) stepBuild(ctx *Context, word string, sol bool) {
+//advance update context `ctx` by word `word` and return prefixes which are followed by this word
+func (r *MarkovChain) advance(ctx *Context, word string) (px [2]Prefix, n int) {
+	px[0] = ctx.prefix
+	n = 1
 
-	r.addWord(ctx, word, sol)
+	if r.chars {
+		ctx.prefix.lshift()
+		ctx.prefix.put(word)
+		return px, n
+	}
+	if r.skipPunct {
+		return r.advanceSkipping(ctx, word)
+	}
 
-	// if "a , [, b] c" then we add [a b] with same suffix c
-	if ctx.preLastWord != "" && !isWord(ctx.prefix.words[0]) && isWord(ctx.prefix.words[NPREF-1]) {
+	// if "a , [, b] c" then we add [a b] with same suffix c for order 2,
+	// compound words are single tokens, so their parts are not joined here
+	if r.order == 2 && ctx.preLastWord != "" && !isWord(ctx.prefix.words[0]) && isWord(ctx.prefix.last()) {
 		ctx.prefix.words[0] = ctx.preLastWord
-		r.addWord(ctx, word, sol)
+		px[1] = ctx.prefix
+		n = 2
 		ctx.preLastWord = ""
 	}
 
 	// example: "[? a] ."
-	if isWord(ctx.prefix.words[NPREF-1]) && !isWord(word) {
-		ctx.preLastWord = ctx.prefix.words[NPREF-1]
+	if isWord(ctx.prefix.last()) && !isWord(word) {
+		ctx.preLastWord = ctx.prefix.last()
 	}
 
 	ctx.prefix.lshift()
 	ctx.prefix.put(word)
+	return px, n
 }
 
-//Add state in states transitions table and mark/unmark him as start of line using `sol`
-func (r *MarkovChain) addWord(ctx *Context, word string, sol bool) {
+//advanceSkipping update context `ctx` by word `word` like `advance` and return prefix of context followed by word
+//and prefix of last words without punctuation if it differs, so "a , b c" add [a b] with suffix c for any order
+func (r *MarkovChain) advanceSkipping(ctx *Context, word string) (px [2]Prefix, n int) {
+	if ctx.words.n == 0 {
+		ctx.words = r.startPrefix()
+	}
+	px[0] = ctx.prefix
+	n = 1
+	if ctx.words != ctx.prefix {
+		px[1] = ctx.words
+		n = 2
+	}
+	if !isPunct(word) {
+		ctx.words.lshift()
+		ctx.words.put(word)
+	}
+	ctx.prefix.lshift()
+	ctx.prefix.put(word)
+	return px, n
+}
 
-	suf, ok := r.statetab[ctx.prefix]
-	if ok {
-		suf = append(suf, Suffix{sol, word})
-		r.statetab[ctx.prefix] = suf
-	} else {
-		p := Prefix{ctx.prefix.words}
-		r.statetab[p] = []Suffix{Suffix{sol, word}}
+//isPunct return true if token `s` is punctuation which is skipped in prefixes of words
+func isPunct(s string) bool {
+	return s != NONWORD && !isWord(s)
+}
+
+//Add state in states transitions table for prefix `p`
+func (r *MarkovChain) addWord(p Prefix, s Suffix) error {
+	r.lower = nil
+
+	added, err := r.store.Append(p, s)
+	if err != nil {
+		return &StoreError{Op: "append", Err: err}
+	}
+	if added {
 		r.keys = append(r.keys, &p)
+		r.indexPrefix(&p)
+	}
+	r.budget.learn(&p, []Suffix{s})
+	return r.evict()
+}
+
+//indexPrefix add prefix `p` to word index for every distinct normalized word of prefix
+func (r *MarkovChain) indexPrefix(p *Prefix) {
+	for _, key := range r.indexKeys(p) {
+		r.index[key] = append(r.index[key], p)
+	}
+}
+
+//indexKeys return distinct normalized words of prefix `p` by which it is found in word index.
+//Prefixes ended by NONWORD have no keys because they continue to another text block.
+func (r *MarkovChain) indexKeys(p *Prefix) []string {
+	if p.last() == NONWORD {
+		return nil
+	}
+	var keys []string
+	for i := 0; i < p.n; i++ {
+		if !isWord(p.words[i]) {
+			continue
+		}
+		key := r.norm.Normalize(p.words[i])
+		if r.wordPosition(p, key) != i {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+//prefixLister is implemented by stores which keep list of prefixes and word index themselves,
+//so chain does not copy them into memory
+type prefixLister interface {
+	// prefixAt return prefix `i` in order of addition
+	prefixAt(i int) Prefix
+	// contains return true if store has prefix `p`
+	contains(p Prefix) bool
+	// indexLen return number of prefixes which contain word with normalized form `key`
+	indexLen(key string) int
+	// indexAt return prefix `i` of prefixes which contain word with normalized form `key`
+	indexAt(key string, i int) Prefix
+	// reindex build word index by normalizer of chain `c`
+	reindex(c *MarkovChain)
+}
+
+//hasSuffixes return true if prefix `p` has suffixes in chain
+func (r *MarkovChain) hasSuffixes(p Prefix) bool {
+	if l, ok := r.store.(prefixLister); ok {
+		return l.contains(p)
+	}
+	return len(r.suffixes(p)) > 0
+}
+
+//prefixCount return number of prefixes of chain
+func (r *MarkovChain) prefixCount() int {
+	if _, ok := r.store.(prefixLister); ok {
+		return r.store.Len()
+	}
+	return len(r.keys)
+}
+
+//prefixAt return prefix `i` of chain in order of addition
+func (r *MarkovChain) prefixAt(i int) Prefix {
+	if l, ok := r.store.(prefixLister); ok {
+		return l.prefixAt(i)
+	}
+	return *r.keys[i]
+}
+
+//indexLen return number of prefixes of chain which contain word with normalized form `key`
+func (r *MarkovChain) indexLen(key string) int {
+	if l, ok := r.store.(prefixLister); ok {
+		return l.indexLen(key)
+	}
+	return len(r.index[key])
+}
+
+//indexAt return prefix `i` of prefixes of chain which contain word with normalized form `key`
+func (r *MarkovChain) indexAt(key string, i int) Prefix {
+	if l, ok := r.store.(prefixLister); ok {
+		return l.indexAt(key, i)
+	}
+	return *r.index[key][i]
+}
+
+//triggerPrefix return prefix chosen by policy among prefixes which contain word with normalized form `key`
+//and position of word in it. Return false if word is not in chain.
+func (r *MarkovChain) triggerPrefix(key string) (Prefix, int, bool) {
+	n := r.indexLen(key)
+	if n == 0 {
+		return Prefix{}, 0, false
+	}
+	p := r.indexAt(key, r.policy.findTriggerPrefix(n))
+	return p, r.wordPosition(&p, key), true
+}
+
+//knownPrefix return prefix `p` of words of message if chain has it, otherwise prefix of chain with same
+//normalized words chosen by policy, so words of message match chain in any form. Return `p` if there is no such prefix.
+func (r *MarkovChain) knownPrefix(p Prefix) Prefix {
+	if p.last() == NONWORD || r.hasSuffixes(p) {
+		return p
+	}
+	key := r.norm.Normalize(p.last())
+	var matched []int
+	for i, n := 0, r.indexLen(key); i < n; i++ {
+		if r.sameNormalized(p, r.indexAt(key, i)) {
+			matched = append(matched, i)
+		}
+	}
+	if len(matched) == 0 {
+		return p
+	}
+	return r.indexAt(key, matched[r.policy.findTriggerPrefix(len(matched))])
+}
+
+//sameNormalized return true if prefixes `a` and `b` have same normalized words
+func (r *MarkovChain) sameNormalized(a Prefix, b Prefix) bool {
+	if a.n != b.n {
+		return false
+	}
+	for i := 0; i < a.n; i++ {
+		if a.words[i] != b.words[i] && r.norm.Normalize(a.words[i]) != r.norm.Normalize(b.words[i]) {
+			return false
+		}
 	}
+	return true
+}
 
+//wordPosition return index of first word of prefix `p` with normalized form `key` or -1
+func (r *MarkovChain) wordPosition(p *Prefix, key string) int {
+	for i := 0; i < p.n; i++ {
+		if r.norm.Normalize(p.words[i]) == key {
+			return i
+		}
+	}
+	return -1
+}
+
+//Build states transition table for markov chain from text blocks.
+//Return *ScanError if text block can not be split into tokens, only text blocks before it are added to chain.
+func (r *MarkovChain) Build(textBlocks []string) error {
+	return r.build(textBlocks, nil)
 }
 
-//Build states transition table for markov chain from text blocks
-func (r *MarkovChain) Build(textBlocks []string) {
-	logger := r.logger.With("func", "Build")
+//build add text blocks `textBlocks` written at unix times `dates` to chain, blocks are undated if `dates` is nil
+func (r *MarkovChain) build(textBlocks []string, dates []int64) error {
 	ctx := new(Context)
-	ctx.prefix = *newPrefix(logger, NONWORD, NONWORD)
+	ctx.prefix = r.startPrefix()
 	r.policy.init(r)
 	// TODO: split punctuation?
 
+	dropped := 0
 	for i, s := range textBlocks {
-		s = clearString(s)
-		rd := strings.NewReader(s)
-		sc := bufio.NewScanner(rd)
-		sc.Split(ScanWordsAndPunct)
-		for sc.Scan() {
-			sol := true
-			if i >= NPREF {
-				sol = false
-			}
-			r.stepBuild(ctx, sc.Text(), sol)
+		words, values, keep, err := r.tokenizeBlock(s)
+		r.placeholders.remember(values)
+		if err != nil {
+			r.logger.Errorw("error scanning text block", "func", "Build", "block", i, "error", err)
+			return &ScanError{Block: i, Err: errors.Unwrap(err)}
+		}
+		if !keep {
+			// index of dropped text block is kept for sources of next ones
+			r.nblocks++
+			dropped++
+			continue
+		}
+		if dates != nil {
+			ctx.date = dates[i]
+		}
+		if err := r.addBlock(ctx, words, i); err != nil {
+			return err
+		}
+	}
+	r.logger.Debugw("chain is built", "func", "Build", "blocks", len(textBlocks), "dropped", dropped, "prefixes", len(r.keys))
+	return nil
+}
 
+//addBlock add tokens `words` of text block with index `i` in call of `Build` and date of context to chain
+func (r *MarkovChain) addBlock(ctx *Context, words []string, i int) error {
+	if ctx.date > r.latest {
+		r.latest = ctx.date
+	}
+	if r.chars {
+		// every text block is started by start marker
+		ctx.prefix = r.startPrefix()
+	}
+	ctx.src = NOSOURCE
+	if r.provenance {
+		ctx.src = int32(r.nblocks)
+	}
+	r.nblocks++
+	for _, w := range words {
+		sol := true
+		if i >= NPREF {
+			sol = false
 		}
-		if err := sc.Err(); err != nil {
-			logger.Errorw("error scanning word", err)
+		if err := r.stepBuild(ctx, w, sol); err != nil {
+			return err
 		}
-		r.stepBuild(ctx, NONWORD, false)
 	}
+	return r.stepBuild(ctx, NONWORD, false)
+}
+
+//skipBlock update context `ctx` by tokens `words` of text block like `addBlock` without adding them to chain
+func (r *MarkovChain) skipBlock(ctx *Context, words []string) {
+	if r.chars {
+		ctx.prefix = r.startPrefix()
+	}
+	for _, w := range words {
+		r.advance(ctx, w)
+	}
+	r.advance(ctx, NONWORD)
+}
+
+//prepareText return text block cleared before tokenization
+func (r *MarkovChain) prepareText(s string) string {
+	if r.chars {
+		return strings.TrimSpace(s)
+	}
+	if r.placeholders != nil {
+		s, _ = r.placeholders.replace(s)
+	}
+	return clearString(s)
+}
+
+//splitFunc return split function which produce tokens of chain
+func (r *MarkovChain) splitFunc() bufio.SplitFunc {
+	if r.chars {
+		return bufio.ScanRunes
+	}
+	mode := scanPunct
+	if r.compound {
+		mode |= scanCompound
+	}
+	if r.typography {
+		mode |= scanTypography
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		return scanTokens(data, atEOF, mode)
+	}
+}
+
+//wordsSplitFunc return split function which produce words of message without punctuation
+func (r *MarkovChain) wordsSplitFunc() bufio.SplitFunc {
+	if r.compound {
+		return ScanCompoundOnlyWords
+	}
+	return ScanOnlyWords
+}
+
+//tokenize split text into tokens in same way as `Build`
+func (r *MarkovChain) tokenize(text string) ([]string, error) {
+	sc := bufio.NewScanner(strings.NewReader(r.prepareText(text)))
+	sc.Split(r.splitFunc())
+	var words []string
+	for sc.Scan() {
+		words = append(words, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		return nil, &ScanError{Block: -1, Err: err}
+	}
+	return words, nil
+}
+
+//joinWords join generated words into text and collapse repeated punctuation
+func joinWords(words []string) string {
+	s := strings.Join(words, " ")
+	return reMultiPunct.ReplaceAllString(s, "$1")
+}
+
+//join join generated tokens into text
+func (r *MarkovChain) join(tokens []string) string {
+	if r.chars {
+		return strings.Join(tokens, "")
+	}
+	if r.typography {
+		return joinTypographic(tokens)
+	}
+	return joinWords(tokens)
 }
 
 //Dump internal variables of  Markov chain to text
 func (r *MarkovChain) Dump() string {
-	return fmt.Sprintf("statetab %v\nkeys: %v\n", r.statetab, r.keys)
+	statetab := make(map[Prefix][]Suffix)
+	for _, p := range r.keys {
+		statetab[*p] = r.suffixes(*p)
+	}
+	r.takeErr()
+	return fmt.Sprintf("statetab %v\nkeys: %v\n", statetab, r.keys)
+}
+
+//findSuffix choose suffix of prefix `p` by policy and return false if prefix is unknown.
+//Suffix is sampled by store if it is possible for policy and by weights of suffixes if transitions are weighted.
+//Candidates of suffix are passed through middlewares of policy if it is composed, then blocked words are removed.
+//Also return probability of transition to chosen suffix, so it is not read again to score generated text.
+//Return false if prefix is unknown or middlewares removed all candidates.
+func (r *MarkovChain) findSuffix(p Prefix) (Suffix, float64, bool) {
+	rnd, random := randomOf(r.policy)
+	mws := middlewaresOf(r.policy)
+	if r.filter != nil {
+		mws = append(mws, r.filter.middleware())
+	}
+	if random && len(mws) == 0 {
+		if ss, ok := r.store.(suffixSampler); ok {
+			return ss.sampleSuffix(p, rnd)
+		}
+	}
+	if random && len(mws) > 0 {
+		if tl, ok := r.store.(transitionLister); ok {
+			return r.chooseCandidate(p, tl.transitionsOf(p), nil, mws, rnd)
+		}
+	}
+	sx := r.suffixes(p)
+	if len(sx) == 0 {
+		return Suffix{src: NOSOURCE, word: NONWORD}, 0, false
+	}
+	r.budget.touch(p)
+	weight := r.weightFunc()
+	if len(mws) > 0 {
+		return r.chooseCandidate(p, weighTransitions(sx, weight), sx, mws, rnd)
+	}
+	var s Suffix
+	if weight != nil && random {
+		s = sampleWeighted(sx, weight, rnd)
+	} else {
+		s = r.policy.findSuffix(sx)
+	}
+	return s, suffixProb(sx, s.word, weight), true
+}
+
+//step generate one word for context `ctx` and update context.
+//Return suffix with NONWORD if phrase is ended and false if context is dead end of chain.
+func (r *MarkovChain) step(ctx *Context) (Suffix, bool) {
+	suf, prob, ok := r.findSuffix(ctx.prefix)
+	if !ok {
+		return suf, false
+	}
+	ctx.prob = prob
+
+	if suf.word != NONWORD {
+		ctx.prefix.lshift()
+		ctx.prefix.put(suf.word)
+	} else {
+		ctx.prefix = r.policy.findNextPrefix(r)
+	}
+
+	return suf, true
 }
 
 //generationStep generate one word for context `ctx` and update context
 func (r *MarkovChain) generationStep(ctx *Context) string {
-	sx, ok := r.statetab[ctx.prefix]
+	suf, ok := r.step(ctx)
 	if !ok {
 		return NONWORD
 	}
 
-	suf := r.policy.findSuffix(sx).word
-
-	if suf != NONWORD {
-		ctx.prefix.lshift()
-		ctx.prefix.put(suf)
-	} else {
+	if suf.word == NONWORD {
 		// phrase is ended
-		ctx.prefix = r.policy.findNextPrefix(r)
-		suf = SEP
+		return SEP
 	}
 
-	return suf
+	return suf.word
 }
 
-//GenerateSentence return generated text as `string` with max number of words `nwords`
-func (r *MarkovChain) GenerateSentence(nwords int) (res string) {
-	if len(r.statetab) == 0 {
-		return res
+//GenerateSentence return generated text as `string` with max number of words `nwords`.
+//Return ErrEmptyChain if chain has no transitions, ErrRepeated if novelty policy rejects generated text
+//and ErrBlocked if generated text has blocked content.
+func (r *MarkovChain) GenerateSentence(nwords int) (string, error) {
+	if r.isEmpty() {
+		return "", ErrEmptyChain
 	}
 	r.policy.init(r)
 
-	var words []string
+	g := r.generateChecked(func() generated {
+		var words []string
+		ctx := new(Context)
+		ctx.prefix = r.policy.findFirstPrefix(r)
+
+		for i := 0; i < nwords; i++ {
+			s := r.generationStep(ctx)
+			if s, ok := r.resolvePlaceholder(Suffix{src: NOSOURCE, word: s}); ok {
+				words = append(words, s.word)
+			}
+		}
+		return generated{words: r.balanceQuotes(sourceless(words...))}
+	})
+	err := r.takeErr()
+	if err == nil && g.stop == StopRepeat {
+		err = ErrRepeated
+	}
+	if err == nil && g.stop == StopBlocked {
+		err = ErrBlocked
+	}
+	return r.join(suffixWords(g.words)), err
+}
+
+//GenerateName return one phrase generated from start marker with max number of tokens `ntokens`.
+//It is intended for chain created by `NewCharMarkovChain` to generate names and nicknames.
+//Return ErrEmptyChain if chain has no transitions.
+func (r *MarkovChain) GenerateName(ntokens int) (string, error) {
+	if r.isEmpty() {
+		return "", ErrEmptyChain
+	}
+	r.policy.init(r)
+
+	var tokens []string
+	prefix := r.startPrefix()
+
+	for i := 0; i < ntokens; i++ {
+		suf, _, ok := r.findSuffix(prefix)
+		if !ok {
+			break
+		}
+		s := suf.word
+		if s == NONWORD {
+			break
+		}
+		tokens = append(tokens, s)
+		prefix.lshift()
+		prefix.put(s)
+	}
+
+	return r.join(tokens), r.takeErr()
+}
+
+//generateFrom return words of prefix `prefix` starting from position `from` followed by words generated from this prefix
+//with max number of generated words `nwords` or ended with NONWORD/SEP.
+//Return nil if no words was generated.
+func (r *MarkovChain) generateFrom(prefix Prefix, from int, nwords int) []Suffix {
 	ctx := new(Context)
-	ctx.prefix = r.policy.findFirstPrefix(r)
+	ctx.prefix = prefix
 
+	var words []Suffix
 	for i := 0; i < nwords; i++ {
-		s := r.generationStep(ctx)
-		words = append(words, s)
+		s, _ := r.step(ctx)
+		if s.word == NONWORD || s.word == SEP {
+			break
+		}
+		if s, ok := r.resolvePlaceholder(s); ok {
+			words = append(words, s)
+		}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	return r.balanceQuotes(append(sourceless(prefix.words[from:prefix.n]...), words...))
+}
+
+//selectPhrases return phrases `phrases` with their candidates and triggers at ascending indices `keep`
+func selectPhrases(keep []int, phrases []string, candidates []generated, triggers []string) ([]string, []generated, []string) {
+	for j, i := range keep {
+		phrases[j], candidates[j], triggers[j] = phrases[i], candidates[i], triggers[i]
+	}
+	return phrases[:len(keep)], candidates[:len(keep)], triggers[:len(keep)]
+}
+
+//sourceless return suffixes for words which are not taken from text blocks
+func sourceless(words ...string) []Suffix {
+	sx := make([]Suffix, len(words))
+	for i, w := range words {
+		sx[i] = Suffix{src: NOSOURCE, word: w}
 	}
+	return sx
+}
 
-	res = strings.Join(words, " ")
-	res = reMultiPunct.ReplaceAllString(res, "$1")
-	return res
+//suffixWords return words of suffixes
+func suffixWords(sx []Suffix) []string {
+	words := make([]string, len(sx))
+	for i, s := range sx {
+		words[i] = s.word
+	}
+	return words
 }
 
-//GenerateAnswer return generated answer for text `message` with max number of words `nwords` or ended with NONWORD/SEP
-func (r *MarkovChain) GenerateAnswer(message string, nwords int) (res string) {
-	logger := r.logger.With("func", "GenerateAnswer")
+//GenerateAnswer return generated answer for text `message` with max number of words `nwords` or ended with NONWORD/SEP.
+//Return ErrEmptyChain if chain has no transitions, ErrNoAnswer if no word of message triggers answer
+//ErrRepeated if novelty policy rejects all phrases and ErrBlocked if all phrases have blocked content.
+func (r *MarkovChain) GenerateAnswer(message string, nwords int) (string, error) {
+	if r.isEmpty() {
+		return "", ErrEmptyChain
+	}
 
-	if len(r.statetab) == 0 {
-		return res
+	g, trigger, err := r.answer(message, func(prefix Prefix, from int) generated {
+		return generated{words: r.generateFrom(prefix, from, nwords)}
+	})
+	if serr := r.takeErr(); err == nil {
+		err = serr
+	}
+	if err != nil {
+		return "", err
 	}
+	if g.stop == StopRepeat {
+		return "", ErrRepeated
+	}
+	if g.stop == StopBlocked {
+		return "", ErrBlocked
+	}
+	if trigger == "" {
+		return "", ErrNoAnswer
+	}
+
+	return r.join(suffixWords(g.words)), nil
+}
+
+//answer return answer for text `message` which is chosen from phrases generated by `generate` for every word of message
+//and word of message which triggered it. Phrases with blocked content and phrases which are recent for novelty policy
+//are not chosen.
+//`generate` return words of prefix starting from position `from` followed by generated words.
+func (r *MarkovChain) answer(message string, generate func(prefix Prefix, from int) generated) (res generated, trigger string, err error) {
 	r.policy.init(r)
 
 	var phrases []string
+	var candidates []generated
+	var triggers []string
 
-	prefix := *newPrefix(logger, NONWORD, NONWORD)
+	prefix := r.startPrefix()
 
 	sr := strings.NewReader(message)
 	sc := bufio.NewScanner(sr)
-	sc.Split(ScanOnlyWords)
+	sc.Split(r.wordsSplitFunc())
 	for sc.Scan() {
 		w := sc.Text()
 
 		prefix.lshift()
 		prefix.put(w)
 
-		ctx := new(Context)
-		ctx.prefix = prefix
-
-		var words []string
-		for i, s := 0, r.generationStep(ctx); i < nwords && s != NONWORD && s != SEP; i, s = i+1, r.generationStep(ctx) {
-			words = append(words, s)
+		//remove nonword from start
+		k := 0
+		for i := 0; i < prefix.n && prefix.words[i] == NONWORD; i++ {
+			k++
 		}
-		if len(words) > 0 {
-			//remove nonword from start
-			k := 0
-			for i := 0; i < NPREF && prefix.words[i] == NONWORD; i++ {
-				k++
+		g := generate(r.knownPrefix(prefix), k)
+
+		// seed generation from occurrence of word in any position and any form of prefix
+		if len(g.words) == 0 {
+			if p, from, ok := r.triggerPrefix(r.norm.Normalize(w)); ok {
+				g = generate(p, from)
 			}
-			words = append(prefix.words[k:NPREF], words...)
-			s := strings.Join(words, " ")
-			s = reMultiPunct.ReplaceAllString(s, "$1")
-			phrases = append(phrases, s)
+		}
+
+		if len(g.words) > 0 {
+			phrases = append(phrases, r.join(suffixWords(g.words)))
+			candidates = append(candidates, g)
+			triggers = append(triggers, w)
 		}
 	}
 	if err := sc.Err(); err != nil {
-		logger.Errorw("error scanning", err)
-		return res
+		return res, trigger, &ScanError{Block: -1, Err: err}
+	}
+	if r.filter != nil && len(phrases) > 0 {
+		var keep []int
+		for i, p := range phrases {
+			if !r.blocked(p) {
+				keep = append(keep, i)
+			}
+		}
+		if len(keep) == 0 {
+			return generated{stop: StopBlocked}, "", nil
+		}
+		phrases, candidates, triggers = selectPhrases(keep, phrases, candidates, triggers)
+	}
+	if np, ok := noveltyOf(r.policy); ok && len(phrases) > 0 {
+		keep := novelTexts(np, phrases)
+		if len(keep) == 0 {
+			return generated{stop: StopRepeat}, "", nil
+		}
+		phrases, candidates, triggers = selectPhrases(keep, phrases, candidates, triggers)
 	}
 	if len(phrases) > 0 {
-		res = r.policy.findPhrase(phrases)
+		phrase := r.policy.findPhrase(phrases)
+		for i := range phrases {
+			if phrases[i] == phrase {
+				r.rememberText(candidates[i].words)
+				return candidates[i], triggers[i], nil
+			}
+		}
 	}
 
-	return res
+	return res, trigger, nil
 }
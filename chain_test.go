@@ -1,19 +1,16 @@
 package xrich
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
 
-var logger *zap.Logger
-
-func init() {
-	logger, _ = zap.NewDevelopment()
-}
-
 //testGeneratePolicy is mock
 type testGeneratePolicy struct {
 }
@@ -22,10 +19,13 @@ func (r testGeneratePolicy) init(c *MarkovChain) {
 }
 
 func (r testGeneratePolicy) findFirstPrefix(c *MarkovChain) Prefix {
-	return *c.keys[0]
+	return c.prefixAt(0)
 }
 func (r testGeneratePolicy) findNextPrefix(c *MarkovChain) Prefix {
-	return *c.keys[0]
+	return c.prefixAt(0)
+}
+func (r testGeneratePolicy) findTriggerPrefix(n int) int {
+	return 0
 }
 func (r testGeneratePolicy) findSuffix(sx []Suffix) Suffix {
 	return sx[0]
@@ -36,64 +36,230 @@ func (r testGeneratePolicy) findPhrase(ss []string) string {
 
 func TestGenerate1(t *testing.T) {
 	ss := []string{"a b c"}
-	c := NewMarkovChain(logger)
+	c := NewMarkovChain()
 	c.SetGeneratePolicy(testGeneratePolicy{})
-	c.Build(ss)
-	s := c.GenerateSentence(3)
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateSentence(3)
+	assert.NoError(t, err)
 	assert.Equal(t, "a b c", s)
 }
 
 func TestGenerate2(t *testing.T) {
 	ss := []string{"a b c b", "b c d"}
-	c := NewMarkovChain(logger)
+	c := NewMarkovChain()
 	c.SetGeneratePolicy(testGeneratePolicy{})
-	c.Build(ss)
-	s := c.GenerateSentence(6)
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateSentence(6)
+	assert.NoError(t, err)
 	assert.Equal(t, "a b c b . a", s)
 }
 
 func TestAnswer1(t *testing.T) {
 	ss := []string{"a b c b", "b c d"}
-	c := NewMarkovChain(logger)
+	c := NewMarkovChain()
 	c.SetGeneratePolicy(testGeneratePolicy{})
-	c.Build(ss)
-	s := c.GenerateAnswer("a", 6)
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("a", 6)
+	assert.NoError(t, err)
 	assert.Equal(t, "a b c b", s)
 }
 
 func TestAnswer2(t *testing.T) {
 	ss := []string{"a b c b", "b c d"}
-	c := NewMarkovChain(logger)
+	c := NewMarkovChain()
 	c.SetGeneratePolicy(testGeneratePolicy{})
-	c.Build(ss)
-	s := c.GenerateAnswer("b", 6)
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("b", 6)
+	assert.NoError(t, err)
 	assert.Equal(t, "b c b", s)
 }
 
 func TestAnswer3(t *testing.T) {
 	ss := []string{"\u2318a, b: c- b.", "b c d"}
-	c := NewMarkovChain(logger)
+	c := NewMarkovChain()
 	c.SetGeneratePolicy(testGeneratePolicy{})
-	c.Build(ss)
+	assert.NoError(t, c.Build(ss))
 	fmt.Println(c.Dump())
-	s := c.GenerateAnswer("b", 6)
+	s, err := c.GenerateAnswer("b", 6)
+	assert.NoError(t, err)
 	assert.Equal(t, "b c - b", s)
 }
 
 func TestAnswer4(t *testing.T) {
 	ss := []string{"a, .  b c b . .", "b c d"}
-	c := NewMarkovChain(logger)
+	c := NewMarkovChain()
 	c.SetGeneratePolicy(testGeneratePolicy{})
-	c.Build(ss)
-	s := c.GenerateAnswer("a", 10)
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("a", 10)
+	assert.NoError(t, err)
 	assert.Equal(t, "a ,", s)
 }
 
 func TestAnswer5(t *testing.T) {
 	ss := []string{"a, .  b c b . .", "b c d"}
-	c := NewMarkovChain(logger)
+	c := NewMarkovChain()
 	c.SetGeneratePolicy(testGeneratePolicy{})
-	c.Build(ss)
-	s := c.GenerateAnswer("b,c", 10)
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("b,c", 10)
+	assert.NoError(t, err)
 	assert.Equal(t, "b c b", s)
 }
+
+func TestAnswerIndex1(t *testing.T) {
+	ss := []string{"x a b c", "y d"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("b", 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "b c", s)
+}
+
+func TestAnswerIndex2(t *testing.T) {
+	ss := []string{"x a b c", "y d"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	assert.Len(t, c.index["b"], 2)
+	assert.Len(t, c.index["d"], 1)
+	assert.Empty(t, c.index[NONWORD])
+	s, err := c.GenerateAnswer("a", 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c", s)
+}
+
+func TestAnswerNormalized1(t *testing.T) {
+	ss := []string{"мой кот спит", "кот"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("Кот", 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "кот спит", s)
+	_, err = c.GenerateAnswer("кота", 6)
+	assert.Equal(t, ErrNoAnswer, err)
+	c.SetNormalizer(StemNormalizer{})
+	s, err = c.GenerateAnswer("Кота", 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "кот спит", s)
+}
+
+func TestAnswerNormalized2(t *testing.T) {
+	ss := []string{"x b d", "b c"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("b", 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "b c", s)
+	// prefix of message is matched in any form before word is looked up in index
+	s, err = c.GenerateAnswer("B", 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "b c", s)
+}
+
+func TestEmptyChain1(t *testing.T) {
+	c := NewMarkovChain()
+	_, err := c.GenerateSentence(3)
+	assert.Equal(t, ErrEmptyChain, err)
+	_, err = c.GenerateAnswer("a", 3)
+	assert.Equal(t, ErrEmptyChain, err)
+}
+
+func TestBuildError1(t *testing.T) {
+	c := NewMarkovChain()
+	c.SetLogger(zap.NewNop().Sugar())
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	err := c.Build([]string{"a b", "c " + strings.Repeat("d", bufio.MaxScanTokenSize), "e f"})
+	if assert.IsType(t, &ScanError{}, err) {
+		assert.Equal(t, 1, err.(*ScanError).Block)
+		assert.Equal(t, bufio.ErrTooLong, errors.Unwrap(err))
+	}
+	s, err := c.GenerateSentence(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b", s)
+}
+
+func TestNewPrefix1(t *testing.T) {
+	_, err := newPrefix()
+	assert.Equal(t, ErrInvalidOrder, err)
+	_, err = newPrefix("a", "b", "c", "d", "e")
+	assert.Equal(t, ErrInvalidOrder, err)
+	p, err := newPrefix("a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", p.last())
+}
+
+func TestCompoundWords1(t *testing.T) {
+	scan := func(split bufio.SplitFunc, text string) []string {
+		sc := bufio.NewScanner(strings.NewReader(text))
+		sc.Split(split)
+		var tokens []string
+		for sc.Scan() {
+			tokens = append(tokens, sc.Text())
+		}
+		return tokens
+	}
+	text := "кто-то из-за don't - e-mail, 'a' b-"
+	assert.Equal(t, []string{"кто-то", "из-за", "don't", "-", "e-mail", ",", "'a", "'", "b", "-"},
+		scan(ScanCompoundWordsAndPunct, text))
+	assert.Equal(t, []string{"кто-то", "из-за", "don't", "e-mail", "a", "b"}, scan(ScanCompoundOnlyWords, text))
+	assert.Equal(t, []string{"кто", "-то"}, scan(ScanWordsAndPunct, "кто-то"))
+}
+
+func TestCompoundWords2(t *testing.T) {
+	ss := []string{"кто-то пришел", "то пришло"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	c.SetCompoundWords(true)
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("кто-то", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "кто-то пришел", s)
+	_, err = c.GenerateAnswer("кто", 5)
+	assert.Equal(t, ErrNoAnswer, err)
+}
+
+func TestSkipPunctuation1(t *testing.T) {
+	next := func(c *MarkovChain, words ...string) []string {
+		p, err := newPrefix(words...)
+		assert.NoError(t, err)
+		return suffixWords(c.suffixes(*p))
+	}
+	ss := []string{"a, b, c"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	assert.Equal(t, []string{","}, next(&c, "a", "b"))
+
+	c = NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	c.SetSkipPunctuation(true)
+	assert.NoError(t, c.Build(ss))
+	assert.Equal(t, []string{",", "c"}, next(&c, "a", "b"))
+	assert.Equal(t, []string{",", "b"}, next(&c, NONWORD, "a"))
+	assert.Equal(t, []string{NONWORD}, next(&c, "b", "c"))
+
+	// runs of punctuation are skipped for any order
+	c = NewMarkovChain()
+	assert.NoError(t, c.SetOrder(3))
+	c.SetSkipPunctuation(true)
+	assert.NoError(t, c.Build([]string{"a, b - - c d"}))
+	assert.Equal(t, []string{"d"}, next(&c, "a", "b", "c"))
+	// prefix of words is followed by every token until next word
+	assert.Equal(t, []string{"-", "-", "c"}, next(&c, NONWORD, "a", "b"))
+}
+
+func TestSetOrder1(t *testing.T) {
+	c := NewMarkovChain()
+	assert.Equal(t, ErrInvalidOrder, c.SetOrder(0))
+	assert.Equal(t, ErrInvalidOrder, c.SetOrder(MAXNPREF+1))
+	assert.NoError(t, c.SetOrder(3))
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build([]string{"a b c d"}))
+	assert.Equal(t, ErrIncompatible, c.SetOrder(2))
+	assert.Equal(t, 3, c.prefixAt(0).n)
+	s, err := c.GenerateAnswer("b", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "b c d", s)
+}
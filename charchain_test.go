@@ -0,0 +1,52 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCharGenerate1(t *testing.T) {
+	ss := []string{"anna", "bob"}
+	c, err := NewCharMarkovChain(3)
+	assert.NoError(t, err)
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateName(10)
+	assert.NoError(t, err)
+	assert.Equal(t, "anna", s)
+	s, err = c.GenerateName(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "ann", s)
+}
+
+func TestCharGenerate2(t *testing.T) {
+	ss := []string{" Анна ", "Аня"}
+	c, err := NewCharMarkovChain(1)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Build(ss))
+	ps, err := c.Predict([]string{"Ан"}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []Prediction{{"а", 1.0 / 3}, {"н", 1.0 / 3}, {"я", 1.0 / 3}}, ps)
+}
+
+func TestCharOrder1(t *testing.T) {
+	_, err := NewCharMarkovChain(0)
+	assert.Equal(t, ErrInvalidOrder, err)
+	_, err = NewCharMarkovChain(MAXNPREF + 1)
+	assert.Equal(t, ErrInvalidOrder, err)
+}
+
+func TestCharScore1(t *testing.T) {
+	ss := []string{"anna", "bob"}
+	c, err := NewCharMarkovChain(2)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Build(ss))
+	s, err := c.Score("bob")
+	assert.NoError(t, err)
+	if assert.Len(t, s.Tokens, 4) {
+		for _, ts := range s.Tokens {
+			assert.True(t, ts.Seen)
+		}
+	}
+}
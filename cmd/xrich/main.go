@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/RedSkotina/xrich"
 	"github.com/spf13/pflag"
@@ -25,7 +26,7 @@ type Record struct {
 	Text string `json:"text"`
 }
 
-func parseJSONL(r io.Reader) (res []string) {
+func parseJSONL(r io.Reader) (res []Record) {
 	sc := bufio.NewScanner(r)
 	for sc.Scan() {
 		var rec Record
@@ -44,13 +45,13 @@ func parseJSONL(r io.Reader) (res []string) {
 			continue
 		}
 
-		res = append(res, rec.Text)
+		res = append(res, rec)
 
 	}
 	return res
 }
 
-func joinInputs(readers []io.Reader) (res []string) {
+func joinInputs(readers []io.Reader) (res []Record) {
 	for _, r := range readers {
 		ss := parseJSONL(r)
 		res = append(res, ss...)
@@ -58,6 +59,67 @@ func joinInputs(readers []io.Reader) (res []string) {
 	return res
 }
 
+//datedTexts return text blocks of records `recs` with their dates, records without date are undated
+func datedTexts(recs []Record) []xrich.DatedText {
+	blocks := make([]xrich.DatedText, len(recs))
+	for i, rec := range recs {
+		blocks[i].Text = rec.Text
+		if rec.Date != 0 {
+			blocks[i].Date = time.Unix(rec.Date, 0)
+		}
+	}
+	return blocks
+}
+
+//newContentFilter return filter of words and regular expressions listed one per line in files `wordsPath`
+//and `patternsPath` or nil if nothing is blocked. Personal data is blocked if `personal` is set.
+func newContentFilter(wordsPath string, patternsPath string, personal bool, mask bool) (*xrich.ContentFilter, error) {
+	if wordsPath == "" && patternsPath == "" && !personal {
+		return nil, nil
+	}
+	f := xrich.NewContentFilter()
+	f.Mask = mask
+	if personal {
+		f.BlockPersonalData()
+	}
+	if wordsPath != "" {
+		words, err := readLines(wordsPath)
+		if err != nil {
+			return nil, err
+		}
+		f.BlockWords(words...)
+	}
+	if patternsPath != "" {
+		patterns, err := readLines(patternsPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range patterns {
+			if err := f.BlockPattern(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
+
+//readLines return non-empty lines of file `path`
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var lines []string
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
 func newReaders(filepathes []string) []io.Reader {
 	var readers []io.Reader
 
@@ -77,11 +139,54 @@ func newReaders(filepathes []string) []io.Reader {
 	return readers
 }
 
+//printSpans print generated words with source records `recs` which they are taken from
+func printSpans(spans []xrich.Span, recs []Record) {
+	for _, sp := range spans {
+		words := strings.Join(sp.Words, " ")
+		if sp.Source == xrich.NOSOURCE {
+			fmt.Printf("%q\n", words)
+			continue
+		}
+		fmt.Printf("%q <- #%d %q\n", words, sp.Source, recs[sp.Source].Text)
+	}
+}
+
 func main() {
 	// FLAG (PRIMARY):
 	flag.Int("maxwords", xrich.MAXGEN, "number of generated words")
+	flag.Int("minwords", 0, "min number of generated words before stop at end of sentence")
+	flag.Int("maxchars", 0, "max number of characters in generated text")
+	flag.Int("sentences", 0, "max number of generated sentences")
+	flag.Bool("stopatend", false, "stop at first end of sentence after minwords words")
 	flag.String("question", "", "find answer for question")
 	flag.Bool("gendump", false, "dump state table")
+	flag.Bool("stem", false, "match words of question by stems")
+	flag.Bool("explain", false, "print source text blocks of generated words")
+	flag.Bool("stream", false, "print words as soon as they are generated")
+	flag.String("perplexity", "", "compute perplexity of chain on held-out jsonl file")
+	flag.String("autocomplete", "", "suggest next words for partial phrase")
+	flag.Int("suggestions", 5, "number of suggestions for autocomplete")
+	flag.Int("charorder", 0, "build character chain of given order and generate names instead of sentences")
+	flag.Int("names", 10, "number of generated names for character chain")
+	flag.Int("workers", 0, "number of goroutines building chain, one per CPU if zero")
+	flag.Int("mincount", 0, "prune transitions which occur less times")
+	flag.Int("maxsuffixes", 0, "prune all but given number of most frequent transitions of every prefix")
+	flag.Bool("dropsingle", false, "prune prefixes with single transition")
+	flag.Int("maxvocab", 0, "prune transitions with words out of given number of most frequent words")
+	flag.Float64("minweight", 0, "prune transitions whose weight by age is less than given one")
+	flag.Duration("halflife", 0, "age of transitions which halves their weight, transitions are not weighted if zero")
+	flag.Bool("stats", false, "print size of chain before and after pruning")
+	flag.String("blockwords", "", "file of blocked words, one per line")
+	flag.String("blockpatterns", "", "file of blocked regular expressions, one per line")
+	flag.Bool("blockpersonal", false, "block e-mails, URLs and phone numbers")
+	flag.Bool("maskblocked", false, "remove blocked content from input text blocks instead of dropping them")
+	flag.String("placeholders", "off", "replace URLs, mentions, numbers, hashtags and emoji by placeholders which are filled by seen values or dropped: off, fill or drop")
+	flag.Bool("compound", false, "keep hyphens and apostrophes inside of words")
+	flag.Bool("typography", false, "keep quotes, dashes, ellipses and terminators like ?! as single tokens and balance quotes")
+	flag.Bool("skippunct", false, "also add transitions to prefixes of words without punctuation between them")
+	flag.Int("order", xrich.NPREF, "number of words in prefixes of chain")
+	flag.String("topic", "", "bias generated text towards words of given text")
+	flag.Float64("topicboost", 5, "strength of bias towards topic")
 	flag.Bool("logjson", false, "log to json")
 
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
@@ -114,24 +219,185 @@ func main() {
 	logger = l.Sugar()
 
 	rs := newReaders(flags)
-	t := joinInputs(rs)
-	if len(t) == 0 {
+	recs := joinInputs(rs)
+	if len(recs) == 0 {
 		logger.Fatalw("no valid input files specified")
 	}
 
-	c := xrich.NewMarkovChain(logger.Desugar())
-	c.Build(t)
+	c := xrich.NewMarkovChain()
+	if viper.GetInt("charorder") > 0 {
+		var err error
+		c, err = xrich.NewCharMarkovChain(viper.GetInt("charorder"))
+		if err != nil {
+			logger.Fatalw("failed to create chain", "error", err)
+		}
+	} else if err := c.SetOrder(viper.GetInt("order")); err != nil {
+		logger.Fatalw("failed to create chain", "error", err)
+	}
+	c.SetLogger(logger)
+	if viper.GetBool("stem") {
+		c.SetNormalizer(xrich.StemNormalizer{})
+	}
+	c.SetCompoundWords(viper.GetBool("compound"))
+	c.SetTypography(viper.GetBool("typography"))
+	c.SetSkipPunctuation(viper.GetBool("skippunct"))
+	c.SetProvenance(viper.GetBool("explain"))
+	if viper.GetString("topic") != "" {
+		topic := c.NewTopicBias(viper.GetFloat64("topicboost"))
+		topic.SetTexts(viper.GetString("topic"))
+		c.SetGeneratePolicy(xrich.ComposeGeneratePolicy(new(xrich.RandomGeneratePolicy), topic.Middleware()))
+	}
+	c.SetHalfLife(viper.GetDuration("halflife"))
+	filter, err := newContentFilter(viper.GetString("blockwords"), viper.GetString("blockpatterns"),
+		viper.GetBool("blockpersonal"), viper.GetBool("maskblocked"))
+	if err != nil {
+		logger.Fatalw("failed to create content filter", "error", err)
+	}
+	c.SetContentFilter(filter)
+	switch viper.GetString("placeholders") {
+	case "off":
+	case "fill":
+		c.SetPlaceholders(xrich.PlaceholdersFill)
+	case "drop":
+		c.SetPlaceholders(xrich.PlaceholdersDrop)
+	default:
+		logger.Fatalw("unknown placeholder mode", "placeholders", viper.GetString("placeholders"))
+	}
+	if err := c.BuildDated(datedTexts(recs), viper.GetInt("workers")); err != nil {
+		logger.Fatalw("failed to build chain", "error", err)
+	}
+
+	var before xrich.Stats
+	if viper.GetBool("stats") {
+		var err error
+		if before, err = c.Stats(); err != nil {
+			logger.Fatalw("failed to compute stats", "error", err)
+		}
+	}
+	pruneOpts := xrich.PruneOptions{
+		MinCount:      viper.GetInt("mincount"),
+		MaxSuffixes:   viper.GetInt("maxsuffixes"),
+		DropSingle:    viper.GetBool("dropsingle"),
+		MaxVocabulary: viper.GetInt("maxvocab"),
+		MinWeight:     viper.GetFloat64("minweight"),
+	}
+	if pruneOpts != (xrich.PruneOptions{}) {
+		if err := c.Prune(pruneOpts); err != nil {
+			logger.Fatalw("failed to prune chain", "error", err)
+		}
+	}
+	if viper.GetBool("stats") {
+		after, err := c.Stats()
+		if err != nil {
+			logger.Fatalw("failed to compute stats", "error", err)
+		}
+		fmt.Println("before:", before)
+		fmt.Println("after: ", after)
+		return
+	}
 
 	if viper.GetBool("gendump") {
 		ioutil.WriteFile("markovchain.dump", []byte(c.Dump()), 0644)
 	}
 
-	if viper.GetString("question") == "" {
-		text := c.GenerateSentence(viper.GetInt("maxwords"))
+	if viper.GetString("perplexity") != "" {
+		heldOut := joinInputs(newReaders([]string{viper.GetString("perplexity")}))
+		if len(heldOut) == 0 {
+			logger.Fatalw("no valid held-out file specified")
+		}
+		texts := make([]string, len(heldOut))
+		for i, rec := range heldOut {
+			texts[i] = rec.Text
+		}
+		pp, err := c.Perplexity(texts)
+		if err != nil {
+			logger.Fatalw("failed to compute perplexity", "error", err)
+		}
+		fmt.Println(pp)
+		return
+	}
+
+	if viper.GetString("autocomplete") != "" {
+		phrase := viper.GetString("autocomplete")
+		ps, err := c.Predict(strings.Fields(phrase), viper.GetInt("suggestions"))
+		if err != nil {
+			logger.Fatalw("failed to predict words", "error", err)
+		}
+		for _, p := range ps {
+			fmt.Printf("%s %s\t%.4f\n", phrase, p.Word, p.Prob)
+		}
+		return
+	}
+
+	if viper.GetInt("charorder") > 0 {
+		for i := 0; i < viper.GetInt("names"); i++ {
+			name, err := c.GenerateName(viper.GetInt("maxwords"))
+			if err != nil {
+				logger.Fatalw("failed to generate name", "error", err)
+			}
+			fmt.Println(name)
+		}
+		return
+	}
+
+	opts := xrich.GenerateOptions{
+		MinWords:     viper.GetInt("minwords"),
+		MaxWords:     viper.GetInt("maxwords"),
+		MaxChars:     viper.GetInt("maxchars"),
+		MaxSentences: viper.GetInt("sentences"),
+		StopAtEnd:    viper.GetBool("stopatend"),
+	}
+
+	if viper.GetBool("explain") {
+		var text string
+		var spans []xrich.Span
+		var err error
+		if viper.GetString("question") == "" {
+			text, spans, err = c.GenerateSentenceExplain(opts)
+		} else {
+			text, spans, err = c.GenerateAnswerExplain(viper.GetString("question"), opts)
+		}
+		if err != nil {
+			logger.Warnw("no text generated", "reason", err)
+		}
 		fmt.Println(text)
+		printSpans(spans, recs)
+		return
+	}
+
+	if viper.GetBool("stream") {
+		printToken := func(token string) bool {
+			fmt.Print(token, " ")
+			return true
+		}
+		var res xrich.Result
+		if viper.GetString("question") == "" {
+			res = c.StreamSentence(opts, printToken)
+		} else {
+			res = c.StreamAnswer(viper.GetString("question"), opts, printToken)
+		}
+		fmt.Println()
+		if res.Err != nil {
+			logger.Warnw("no text generated",
+				"reason", res.Err,
+				"stop", res.Stop.String(),
+			)
+		}
+		return
+	}
+
+	var res xrich.Result
+	if viper.GetString("question") == "" {
+		res = c.GenerateSentenceResult(opts)
 	} else {
-		text := c.GenerateAnswer(viper.GetString("question"), viper.GetInt("maxwords"))
-		fmt.Println(text)
+		res = c.GenerateAnswerResult(viper.GetString("question"), opts)
+	}
+	if res.Err != nil {
+		logger.Warnw("no text generated",
+			"reason", res.Err,
+			"stop", res.Stop.String(),
+		)
 	}
+	fmt.Println(res.Text)
 
 }
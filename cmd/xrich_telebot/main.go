@@ -7,6 +7,7 @@ import (
 	"io"
 	"math/rand"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,7 +27,35 @@ func init() {
 	// FLAG (PRIMARY):
 	flag.String("token", "", "Telegram Bot Token")
 	flag.Int("maxwords", xrich.MAXGEN, "number of generated words")
+	flag.Int("minwords", 0, "min number of generated words before stop at end of sentence")
+	flag.Int("maxchars", 4096, "max number of characters in generated text")
+	flag.Int("sentences", 0, "max number of generated sentences")
+	flag.Bool("stopatend", true, "stop at first end of sentence after minwords words")
 	flag.Int("answerProbabality", xrich.MAXGEN, "answer probabality")
+	flag.Bool("stem", false, "match words of messages by stems")
+	flag.String("store", "", "file of persistent chain, input files are learned only if it is empty")
+	flag.Int("workers", 0, "number of goroutines building chain, one per CPU if zero")
+	flag.Duration("halflife", 0, "age of transitions which halves their weight, transitions are not weighted if zero")
+	flag.Int("novelty", 0, "number of recent replies of chat which are not repeated")
+	flag.Bool("learn", false, "learn chain from messages of chat")
+	flag.Int("syncevery", 100, "number of learned messages after which chain store is synced to disk")
+	flag.Duration("syncinterval", time.Minute, "max time after which learned messages are synced to disk")
+	flag.Duration("streaminterval", time.Second, "min time between edits of reply which is sent as soon as words are generated")
+	flag.Int("maxbytes", 0, "approximate max size of chain in bytes, unlimited if zero")
+	flag.Int("maxprefixes", 0, "max number of prefixes of chain, unlimited if zero")
+	flag.String("eviction", "lru", "which prefixes are evicted from chain exceeding its size: lru or lfu")
+	flag.String("blockwords", "", "file of blocked words, one per line")
+	flag.String("blockpatterns", "", "file of blocked regular expressions, one per line")
+	flag.Bool("blockpersonal", false, "block e-mails, URLs and phone numbers")
+	flag.Bool("maskblocked", false, "remove blocked content from input text blocks instead of dropping them")
+	flag.String("placeholders", "off", "replace URLs, mentions, numbers, hashtags and emoji by placeholders which are filled by seen values or dropped: off, fill or drop")
+	flag.Bool("compound", false, "keep hyphens and apostrophes inside of words")
+	flag.Bool("typography", false, "keep quotes, dashes, ellipses and terminators like ?! as single tokens and balance quotes")
+	flag.Bool("skippunct", false, "also add transitions to prefixes of words without punctuation between them")
+	flag.Int("order", xrich.NPREF, "number of words in prefixes of chain, it must match chain of store")
+	flag.Int("topic", 0, "number of recent messages of chat whose words replies are biased towards")
+	flag.Float64("topicboost", 5, "strength of bias towards topic of recent messages")
+	flag.Int("chats", 1000, "max number of chats whose recent messages and replies are remembered, least recently active chats are forgotten")
 	flag.Bool("logjson", false, "log to json")
 
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
@@ -38,8 +67,34 @@ func init() {
 	//XRICH_TELEGRAM_
 	viper.BindEnv("token", "XRICH_TELEGRAM_TOKEN")
 	viper.BindEnv("maxwords", "XRICH_MAX_WORDS")
+	viper.BindEnv("minwords", "XRICH_MIN_WORDS")
+	viper.BindEnv("maxchars", "XRICH_MAX_CHARS")
+	viper.BindEnv("sentences", "XRICH_SENTENCES")
+	viper.BindEnv("stopatend", "XRICH_STOP_AT_END")
 	viper.BindEnv("answerProbabality", "XRICH_ANSWER_PROBABALITY")
 	viper.BindEnv("infiles", "XRICH_INPUT_FILES")
+	viper.BindEnv("stem", "XRICH_STEM")
+	viper.BindEnv("store", "XRICH_STORE")
+	viper.BindEnv("workers", "XRICH_WORKERS")
+	viper.BindEnv("halflife", "XRICH_HALF_LIFE")
+	viper.BindEnv("novelty", "XRICH_NOVELTY")
+	viper.BindEnv("learn", "XRICH_LEARN")
+	viper.BindEnv("syncevery", "XRICH_SYNC_EVERY")
+	viper.BindEnv("syncinterval", "XRICH_SYNC_INTERVAL")
+	viper.BindEnv("maxbytes", "XRICH_MAX_BYTES")
+	viper.BindEnv("maxprefixes", "XRICH_MAX_PREFIXES")
+	viper.BindEnv("eviction", "XRICH_EVICTION")
+	viper.BindEnv("blockwords", "XRICH_BLOCK_WORDS")
+	viper.BindEnv("blockpatterns", "XRICH_BLOCK_PATTERNS")
+	viper.BindEnv("blockpersonal", "XRICH_BLOCK_PERSONAL")
+	viper.BindEnv("maskblocked", "XRICH_MASK_BLOCKED")
+	viper.BindEnv("placeholders", "XRICH_PLACEHOLDERS")
+	viper.BindEnv("compound", "XRICH_COMPOUND_WORDS")
+	viper.BindEnv("typography", "XRICH_TYPOGRAPHY")
+	viper.BindEnv("skippunct", "XRICH_SKIP_PUNCT")
+	viper.BindEnv("topic", "XRICH_TOPIC")
+	viper.BindEnv("topicboost", "XRICH_TOPIC_BOOST")
+	viper.BindEnv("chats", "XRICH_CHATS")
 
 	// DEFAULT:
 	viper.SetDefault("token", "")
@@ -74,7 +129,7 @@ type Record struct {
 	Text string `json:"text"`
 }
 
-func parseJSONL(r io.Reader) (res []string) {
+func parseJSONL(r io.Reader) (res []Record) {
 	sc := bufio.NewScanner(r)
 	for sc.Scan() {
 		var rec Record
@@ -93,13 +148,13 @@ func parseJSONL(r io.Reader) (res []string) {
 			continue
 		}
 
-		res = append(res, rec.Text)
+		res = append(res, rec)
 
 	}
 	return res
 }
 
-func joinInputs(readers []io.Reader) (res []string) {
+func joinInputs(readers []io.Reader) (res []Record) {
 	for _, r := range readers {
 		ss := parseJSONL(r)
 		res = append(res, ss...)
@@ -107,6 +162,147 @@ func joinInputs(readers []io.Reader) (res []string) {
 	return res
 }
 
+//datedTexts return text blocks of records `recs` with their dates, records without date are undated
+func datedTexts(recs []Record) []xrich.DatedText {
+	blocks := make([]xrich.DatedText, len(recs))
+	for i, rec := range recs {
+		blocks[i].Text = rec.Text
+		if rec.Date != 0 {
+			blocks[i].Date = time.Unix(rec.Date, 0)
+		}
+	}
+	return blocks
+}
+
+//recentMessages keep recent messages of chats, messages of least recently active chats are forgotten
+type recentMessages struct {
+	size     int // number of messages of chat
+	maxChats int // max number of chats, unlimited if zero
+	texts    map[int64][]string
+	used     map[int64]int // time of last message of chat counted in messages
+	clock    int
+}
+
+func newRecentMessages(size int, maxChats int) *recentMessages {
+	return &recentMessages{size: size, maxChats: maxChats, texts: make(map[int64][]string), used: make(map[int64]int)}
+}
+
+//add add message `text` of chat `chat` to recent messages
+func (r *recentMessages) add(chat int64, text string) {
+	msgs := append(r.texts[chat], text)
+	if len(msgs) > r.size {
+		msgs = msgs[len(msgs)-r.size:]
+	}
+	r.texts[chat] = msgs
+	r.clock++
+	r.used[chat] = r.clock
+	if r.maxChats <= 0 || len(r.texts) <= r.maxChats {
+		return
+	}
+	oldest, min := chat, r.clock
+	for c, t := range r.used {
+		if t < min {
+			oldest, min = c, t
+		}
+	}
+	delete(r.texts, oldest)
+	delete(r.used, oldest)
+}
+
+//streamReply send answer of chain `c` for message `text` to chat `chat` as soon as its words are generated:
+//reply is sent with first words and edited by next words not more often than `interval`.
+//Reply is deleted if whole answer is blocked by filter `filter`. Return details of answer.
+func streamReply(bot *tgbotapi.BotAPI, c *xrich.MarkovChain, filter *xrich.ContentFilter, chat int64, text string, opts xrich.GenerateOptions, interval time.Duration) xrich.Result {
+	var sent tgbotapi.Message
+	var tokens []string
+	shown := ""
+	var last time.Time
+	show := func(reply string) {
+		if reply == "" || reply == shown {
+			return
+		}
+		var err error
+		if sent.MessageID == 0 {
+			sent, err = bot.Send(tgbotapi.NewMessage(chat, reply))
+		} else {
+			_, err = bot.Send(tgbotapi.NewEditMessageText(chat, sent.MessageID, reply))
+		}
+		if err != nil {
+			logger.Warnw("unable to send reply", "error", err)
+			return
+		}
+		shown, last = reply, time.Now()
+	}
+	res := c.StreamAnswer(text, opts, func(token string) bool {
+		tokens = append(tokens, token)
+		if time.Since(last) >= interval {
+			show(c.JoinTokens(tokens))
+		}
+		return true
+	})
+	if filter != nil && filter.Blocked(res.Text) {
+		if sent.MessageID != 0 {
+			if _, err := bot.DeleteMessage(tgbotapi.DeleteMessageConfig{ChatID: chat, MessageID: sent.MessageID}); err != nil {
+				logger.Warnw("unable to delete blocked reply", "error", err)
+			}
+		}
+		res.Err = xrich.ErrBlocked
+		return res
+	}
+	// whole answer is joined with closed quotes, so last words are shown even if they were generated quickly
+	show(res.Text)
+	return res
+}
+
+//newContentFilter return filter of words and regular expressions listed one per line in files `wordsPath`
+//and `patternsPath` or nil if nothing is blocked. Personal data is blocked if `personal` is set.
+func newContentFilter(wordsPath string, patternsPath string, personal bool, mask bool) (*xrich.ContentFilter, error) {
+	if wordsPath == "" && patternsPath == "" && !personal {
+		return nil, nil
+	}
+	f := xrich.NewContentFilter()
+	f.Mask = mask
+	if personal {
+		f.BlockPersonalData()
+	}
+	if wordsPath != "" {
+		words, err := readLines(wordsPath)
+		if err != nil {
+			return nil, err
+		}
+		f.BlockWords(words...)
+	}
+	if patternsPath != "" {
+		patterns, err := readLines(patternsPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range patterns {
+			if err := f.BlockPattern(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return f, nil
+}
+
+//readLines return non-empty lines of file `path`
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var lines []string
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
 func newReaders(filepathes []string) []io.Reader {
 	var readers []io.Reader
 
@@ -137,10 +333,102 @@ func main() {
 	filenames = append(filenames, flags...)
 
 	rs := newReaders(filenames)
-	t := joinInputs(rs)
+	recs := joinInputs(rs)
+
+	c := xrich.NewMarkovChain()
+	if err := c.SetOrder(viper.GetInt("order")); err != nil {
+		logger.Fatalw("failed to create chain", "error", err)
+	}
+	c.SetLogger(logger)
+	c.SetHalfLife(viper.GetDuration("halflife"))
+	filter, err := newContentFilter(viper.GetString("blockwords"), viper.GetString("blockpatterns"),
+		viper.GetBool("blockpersonal"), viper.GetBool("maskblocked"))
+	if err != nil {
+		logger.Fatalw("failed to create content filter", "error", err)
+	}
+	c.SetContentFilter(filter)
+	switch viper.GetString("placeholders") {
+	case "off":
+	case "fill":
+		c.SetPlaceholders(xrich.PlaceholdersFill)
+	case "drop":
+		c.SetPlaceholders(xrich.PlaceholdersDrop)
+	default:
+		logger.Fatalw("unknown placeholder mode", "placeholders", viper.GetString("placeholders"))
+	}
+	var novelty *xrich.NoveltyGeneratePolicy
+	if viper.GetInt("novelty") > 0 {
+		novelty = xrich.NewNoveltyGeneratePolicy(new(xrich.RandomGeneratePolicy), viper.GetInt("novelty"))
+		novelty.Conversations = viper.GetInt("chats")
+		c.SetGeneratePolicy(novelty)
+	}
+	if viper.GetBool("stem") {
+		c.SetNormalizer(xrich.StemNormalizer{})
+	}
+	c.SetCompoundWords(viper.GetBool("compound"))
+	c.SetTypography(viper.GetBool("typography"))
+	c.SetSkipPunctuation(viper.GetBool("skippunct"))
+	var topic *xrich.TopicBias
+	recent := newRecentMessages(viper.GetInt("topic"), viper.GetInt("chats"))
+	if viper.GetInt("topic") > 0 {
+		topic = c.NewTopicBias(viper.GetFloat64("topicboost"))
+		var base xrich.GeneratePolicy = new(xrich.RandomGeneratePolicy)
+		if novelty != nil {
+			base = novelty
+		}
+		c.SetGeneratePolicy(xrich.ComposeGeneratePolicy(base, topic.Middleware()))
+	}
+	budget := xrich.MemoryBudget{
+		MaxBytes:    viper.GetInt("maxbytes"),
+		MaxPrefixes: viper.GetInt("maxprefixes"),
+	}
+	switch viper.GetString("eviction") {
+	case "lru":
+		budget.Eviction = xrich.EvictLRU
+	case "lfu":
+		budget.Eviction = xrich.EvictLFU
+	default:
+		logger.Fatalw("unknown eviction policy", "eviction", viper.GetString("eviction"))
+	}
+	if err := c.SetMemoryBudget(budget); err != nil {
+		logger.Fatalw("failed to set memory budget", "error", err)
+	}
+	learn := true
+	var fs *xrich.FileStore
+	if viper.GetString("store") != "" {
+		var err error
+		fs, err = xrich.OpenFileStore(viper.GetString("store"))
+		if err != nil {
+			logger.Fatalw("failed to open chain store", "path", viper.GetString("store"), "error", err)
+		}
+		defer fs.Close()
+		if err := c.SetStateStore(fs); err != nil {
+			logger.Fatalw("failed to load chain store", "error", err)
+		}
+		learn = fs.Len() == 0
+		logger.Infow("chain store is opened",
+			"path", viper.GetString("store"),
+			"prefixes", fs.Len(),
+		)
+	}
+	if learn {
+		if err := c.BuildDated(datedTexts(recs), viper.GetInt("workers")); err != nil {
+			logger.Fatalw("failed to build chain", "error", err)
+		}
+		if fs != nil {
+			if err := fs.Sync(); err != nil {
+				logger.Fatalw("failed to save chain store", "error", err)
+			}
+		}
+	}
 
-	c := xrich.NewMarkovChain(logger.Desugar())
-	c.Build(t)
+	opts := xrich.GenerateOptions{
+		MinWords:     viper.GetInt("minwords"),
+		MaxWords:     viper.GetInt("maxwords"),
+		MaxChars:     viper.GetInt("maxchars"),
+		MaxSentences: viper.GetInt("sentences"),
+		StopAtEnd:    viper.GetBool("stopatend"),
+	}
 
 	bot, err := tgbotapi.NewBotAPI(viper.GetString("token"))
 	if err != nil {
@@ -162,6 +450,7 @@ func main() {
 	time.Sleep(time.Millisecond * 500)
 	updates.Clear()
 
+	unsynced, synced := 0, time.Now()
 	for update := range updates {
 		if update.Message == nil {
 			continue
@@ -169,23 +458,50 @@ func main() {
 
 		//log.Printf("[%s] %s", update.Message.From.UserName, update.Message.Text)
 
+		if update.Message.Text != "" && viper.GetBool("learn") {
+			block := xrich.DatedText{Text: update.Message.Text, Date: time.Unix(int64(update.Message.Date), 0)}
+			if err := c.BuildDated([]xrich.DatedText{block}, 1); err != nil {
+				logger.Warnw("failed to learn message", "error", err)
+			}
+			unsynced++
+			// syncing after every message is slow, store is synced after several messages or some time
+			if fs != nil && (unsynced >= viper.GetInt("syncevery") || time.Since(synced) >= viper.GetDuration("syncinterval")) {
+				if err := fs.Sync(); err != nil {
+					logger.Errorw("failed to save chain store", "error", err)
+				}
+				unsynced, synced = 0, time.Now()
+			}
+		}
+
+		if update.Message.Text != "" && topic != nil {
+			recent.add(update.Message.Chat.ID, update.Message.Text)
+		}
+
 		if update.Message.Text != "" {
 			if rand.Float64() <= viper.GetFloat64("answerProbability") {
-				reply := c.GenerateAnswer(update.Message.Text, viper.GetInt("maxwords"))
-				if reply != "" {
-					_, err = bot.Send(tgbotapi.NewChatAction(update.Message.Chat.ID, tgbotapi.ChatTyping))
-					if err != nil {
-						logger.Warnw("unable to send 'typing' status to the channel", err)
-					}
-					waitTime := time.Duration((rand.Int()%100000*len(reply))%2000) * time.Millisecond
-					time.Sleep(waitTime)
-
-					msg := tgbotapi.NewMessage(update.Message.Chat.ID, reply)
-
-					_, err = bot.Send(msg)
-					if err != nil {
-						logger.Errorw("unable to send error message", err)
-					}
+				if novelty != nil {
+					novelty.SetConversation(strconv.FormatInt(update.Message.Chat.ID, 10))
+				}
+				if topic != nil {
+					topic.SetTexts(recent.texts[update.Message.Chat.ID]...)
+				}
+				_, err = bot.Send(tgbotapi.NewChatAction(update.Message.Chat.ID, tgbotapi.ChatTyping))
+				if err != nil {
+					logger.Warnw("unable to send 'typing' status to the channel", err)
+				}
+				res := streamReply(bot, &c, filter, update.Message.Chat.ID, update.Message.Text, opts,
+					viper.GetDuration("streaminterval"))
+				if res.Err != nil {
+					logger.Debugw("no reply generated",
+						"reason", res.Err,
+						"stop", res.Stop.String(),
+					)
+				} else {
+					logger.Debugw("reply generated",
+						"trigger", res.Trigger,
+						"stop", res.Stop.String(),
+						"logprob", res.LogProb,
+					)
 				}
 			}
 		}
@@ -0,0 +1,452 @@
+package xrich
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+)
+
+//ErrReadOnly is returned when compiled chain is changed
+var ErrReadOnly = errors.New("xrich: chain is read-only")
+
+//compiledStore is immutable states transitions table where words are replaced by ids,
+//prefixes are sorted and duplicated suffixes are merged into transitions with counts.
+//Every prefix has alias table for sampling of its transitions in constant time.
+type compiledStore struct {
+	order    int
+	words    []string // vocabulary, index is id of word
+	ids      map[string]uint32
+	prefixes []uint32  // ids of words of prefixes in lexicographic order, `order` ids per prefix
+	keys     []uint32  // positions of prefixes in order of addition to chain
+	offsets  []uint32  // transitions of prefix i are in range [offsets[i], offsets[i+1])
+	next     []uint32  // ids of words of transitions
+	counts   []uint32  // numbers of occurrences of transitions
+	probs    []float32 // probability to keep sampled transition, part of alias table
+	aliases  []uint32  // transition taken instead of sampled one relative to first transition of prefix, part of alias table
+	unmap    func() error
+	index    map[string][]uint32 // positions of prefixes by normalized words, built by normalizer of chain
+	// values of placeholders of source chain which are words of vocabulary, nil if placeholders are off
+	placeholders *placeholders
+}
+
+//Compile return immutable compact copy of chain for serving. Suffixes are stored once with number of its occurrences
+//and sampled in constant time by RandomGeneratePolicy. Sources of words, marks of start of line and dates are not kept,
+//so transitions of compiled chain are not weighted by age. Placeholder mode and values of placeholders are kept,
+//so compiled chain resolves placeholders like source chain.
+func (r *MarkovChain) Compile() (*CompiledChain, error) {
+	type entry struct {
+		prefix Prefix
+		ts     []transition
+	}
+	entries := make([]entry, len(r.keys))
+	ids := make(map[string]uint32)
+	for i, p := range r.keys {
+		sx, err := r.store.Get(*p)
+		if err != nil {
+			return nil, &StoreError{Op: "get", Err: err}
+		}
+		entries[i] = entry{*p, countTransitions(sx)}
+		for j := 0; j < p.n; j++ {
+			ids[p.words[j]] = 0
+		}
+		for _, t := range entries[i].ts {
+			ids[t.word] = 0
+		}
+	}
+	ph := r.placeholders.clone()
+	if ph != nil {
+		for _, vs := range ph.values {
+			for _, v := range vs {
+				ids[v] = 0
+			}
+		}
+	}
+
+	s := &compiledStore{order: r.order, ids: ids, placeholders: ph}
+	for w := range ids {
+		s.words = append(s.words, w)
+	}
+	sort.Strings(s.words)
+	for i, w := range s.words {
+		ids[w] = uint32(i)
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := entries[order[i]].prefix, entries[order[j]].prefix
+		for k := 0; k < r.order; k++ {
+			if a.words[k] != b.words[k] {
+				return ids[a.words[k]] < ids[b.words[k]]
+			}
+		}
+		return false
+	})
+
+	s.keys = make([]uint32, len(entries))
+	s.offsets = append(s.offsets, 0)
+	for pos, i := range order {
+		e := entries[i]
+		s.keys[i] = uint32(pos)
+		for k := 0; k < r.order; k++ {
+			s.prefixes = append(s.prefixes, ids[e.prefix.words[k]])
+		}
+		for _, t := range e.ts {
+			s.next = append(s.next, ids[t.word])
+			s.counts = append(s.counts, uint32(t.count))
+		}
+		s.offsets = append(s.offsets, uint32(len(s.next)))
+	}
+	s.probs = make([]float32, len(s.next))
+	s.aliases = make([]uint32, len(s.next))
+	for i := 0; i+1 < len(s.offsets); i++ {
+		lo, hi := s.offsets[i], s.offsets[i+1]
+		buildAlias(s.counts[lo:hi], s.probs[lo:hi], s.aliases[lo:hi])
+	}
+
+	return newCompiledChain(s, r.chars, r.compound, r.typography, r.norm, r.filter, r.logger)
+}
+
+//buildAlias fill alias table `probs`, `aliases` for sampling of index in proportion to `counts` by Vose's method
+func buildAlias(counts []uint32, probs []float32, aliases []uint32) {
+	n := len(counts)
+	var total float64
+	for _, c := range counts {
+		total += float64(c)
+	}
+	scaled := make([]float64, n)
+	var small, large []int
+	for i, c := range counts {
+		scaled[i] = float64(c) * float64(n) / total
+		if scaled[i] < 1 {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+	for len(small) > 0 && len(large) > 0 {
+		s, l := small[len(small)-1], large[len(large)-1]
+		small, large = small[:len(small)-1], large[:len(large)-1]
+		probs[s] = float32(scaled[s])
+		aliases[s] = uint32(l)
+		scaled[l] += scaled[s] - 1
+		if scaled[l] < 1 {
+			small = append(small, l)
+		} else {
+			large = append(large, l)
+		}
+	}
+	for _, i := range append(small, large...) {
+		probs[i] = 1
+		aliases[i] = uint32(i)
+	}
+}
+
+//lookup return position of prefix `p` in sorted prefixes
+func (r *compiledStore) lookup(p Prefix) (int, bool) {
+	if p.n != r.order {
+		return 0, false
+	}
+	var key [MAXNPREF]uint32
+	for k := 0; k < r.order; k++ {
+		id, ok := r.ids[p.words[k]]
+		if !ok {
+			return 0, false
+		}
+		key[k] = id
+	}
+	n := len(r.offsets) - 1
+	i := sort.Search(n, func(i int) bool {
+		pk := r.prefixes[i*r.order : (i+1)*r.order]
+		for k := range pk {
+			if pk[k] != key[k] {
+				return pk[k] > key[k]
+			}
+		}
+		return true
+	})
+	if i == n {
+		return 0, false
+	}
+	for k := 0; k < r.order; k++ {
+		if r.prefixes[i*r.order+k] != key[k] {
+			return 0, false
+		}
+	}
+	return i, true
+}
+
+//prefix return prefix at position `i` of sorted prefixes
+func (r *compiledStore) prefix(i int) Prefix {
+	p := Prefix{n: r.order}
+	for k := 0; k < r.order; k++ {
+		p.words[k] = r.words[r.prefixes[i*r.order+k]]
+	}
+	return p
+}
+
+//Get return suffixes of prefix `p` repeated by number of its occurrences or nil if prefix is unknown
+func (r *compiledStore) Get(p Prefix) ([]Suffix, error) {
+	i, ok := r.lookup(p)
+	if !ok {
+		return nil, nil
+	}
+	var sx []Suffix
+	for j := r.offsets[i]; j < r.offsets[i+1]; j++ {
+		s := Suffix{src: NOSOURCE, word: r.words[r.next[j]]}
+		for c := uint32(0); c < r.counts[j]; c++ {
+			sx = append(sx, s)
+		}
+	}
+	return sx, nil
+}
+
+//Append return ErrReadOnly
+func (r *compiledStore) Append(p Prefix, s Suffix) (bool, error) {
+	return false, ErrReadOnly
+}
+
+//Set return ErrReadOnly
+func (r *compiledStore) Set(p Prefix, sx []Suffix) error {
+	return ErrReadOnly
+}
+
+//Len return number of prefixes
+func (r *compiledStore) Len() int {
+	return len(r.keys)
+}
+
+//Range call `f` for every prefix in order of addition to source chain until `f` return false
+func (r *compiledStore) Range(f func(p Prefix) bool) error {
+	for _, i := range r.keys {
+		if !f(r.prefix(int(i))) {
+			break
+		}
+	}
+	return nil
+}
+
+//prefixAt return prefix `i` in order of addition to source chain
+func (r *compiledStore) prefixAt(i int) Prefix {
+	return r.prefix(int(r.keys[i]))
+}
+
+//contains return true if store has prefix `p`
+func (r *compiledStore) contains(p Prefix) bool {
+	_, ok := r.lookup(p)
+	return ok
+}
+
+//indexLen return number of prefixes which contain word with normalized form `key`
+func (r *compiledStore) indexLen(key string) int {
+	return len(r.index[key])
+}
+
+//indexAt return prefix `i` of prefixes which contain word with normalized form `key`
+func (r *compiledStore) indexAt(key string, i int) Prefix {
+	return r.prefix(int(r.index[key][i]))
+}
+
+//reindex build word index of prefixes by normalizer of chain `c`
+func (r *compiledStore) reindex(c *MarkovChain) {
+	r.index = make(map[string][]uint32)
+	for _, i := range r.keys {
+		p := r.prefix(int(i))
+		for _, key := range c.indexKeys(&p) {
+			r.index[key] = append(r.index[key], i)
+		}
+	}
+}
+
+//sampleSuffix return random suffix of prefix `p` with probability proportional to number of its occurrences
+func (r *compiledStore) sampleSuffix(p Prefix, rnd *rand.Rand) (Suffix, float64, bool) {
+	i, ok := r.lookup(p)
+	if !ok {
+		return Suffix{src: NOSOURCE, word: NONWORD}, 0, false
+	}
+	lo, hi := r.offsets[i], r.offsets[i+1]
+	j := lo + uint32(rnd.Intn(int(hi-lo)))
+	if rnd.Float32() >= r.probs[j] {
+		j = lo + r.aliases[j]
+	}
+	var total uint32
+	for k := lo; k < hi; k++ {
+		total += r.counts[k]
+	}
+	return Suffix{src: NOSOURCE, word: r.words[r.next[j]]}, float64(r.counts[j]) / float64(total), true
+}
+
+//transitionsOf return distinct transitions of prefix `p` from its counts without expanding them into suffixes
+func (r *compiledStore) transitionsOf(p Prefix) []transition {
+	i, ok := r.lookup(p)
+	if !ok {
+		return nil
+	}
+	lo, hi := r.offsets[i], r.offsets[i+1]
+	var total uint32
+	for k := lo; k < hi; k++ {
+		total += r.counts[k]
+	}
+	ts := make([]transition, 0, hi-lo)
+	for k := lo; k < hi; k++ {
+		ts = append(ts, transition{word: r.words[r.next[k]], count: int(r.counts[k]), prob: float64(r.counts[k]) / float64(total)})
+	}
+	return ts
+}
+
+//suffixSampler is implemented by stores which sample suffix of prefix without reading all its suffixes.
+//Probability of sampled suffix is returned with it.
+type suffixSampler interface {
+	sampleSuffix(p Prefix, rnd *rand.Rand) (Suffix, float64, bool)
+}
+
+//transitionLister is implemented by stores which keep transitions of prefix counted
+type transitionLister interface {
+	transitionsOf(p Prefix) []transition
+}
+
+//randomPolicy is implemented by policies which choose suffix uniformly among all occurrences,
+//so suffix can be sampled by store
+type randomPolicy interface {
+	random() *rand.Rand
+}
+
+//CompiledChain is immutable chain produced by `Compile` with same generation methods as MarkovChain.
+//Like MarkovChain it is not safe for concurrent use.
+type CompiledChain struct {
+	chain MarkovChain
+	store *compiledStore
+}
+
+func newCompiledChain(s *compiledStore, chars bool, compound bool, typography bool, norm Normalizer, filter *ContentFilter, logger Logger) (*CompiledChain, error) {
+	c := NewMarkovChain()
+	c.order = s.order
+	c.chars = chars
+	c.compound = compound
+	c.typography = typography
+	c.filter = filter
+	c.placeholders = s.placeholders
+	c.logger = logger
+	// prefixes and word index are served from arrays of store instead of keys and index of chain
+	c.store = s
+	c.SetNormalizer(norm)
+	return &CompiledChain{chain: c, store: s}, nil
+}
+
+//SetGeneratePolicy allow change choice policy of elements in key transitions
+func (r *CompiledChain) SetGeneratePolicy(p GeneratePolicy) {
+	r.chain.SetGeneratePolicy(p)
+}
+
+//SetNormalizer allow change how words of message are matched with words of chain
+func (r *CompiledChain) SetNormalizer(n Normalizer) {
+	r.chain.SetNormalizer(n)
+}
+
+//SetLogger set logger of chain. Nil logger disable logging.
+func (r *CompiledChain) SetLogger(l Logger) {
+	r.chain.SetLogger(l)
+}
+
+//SetContentFilter set filter of blocked content which is applied to generated texts.
+//Compiled chain keeps filter of source chain, nil filter disables filtering.
+func (r *CompiledChain) SetContentFilter(f *ContentFilter) {
+	r.chain.SetContentFilter(f)
+}
+
+//Len return number of prefixes of chain
+func (r *CompiledChain) Len() int {
+	return r.store.Len()
+}
+
+//GenerateSentence is same as `MarkovChain.GenerateSentence`
+func (r *CompiledChain) GenerateSentence(nwords int) (string, error) {
+	return r.chain.GenerateSentence(nwords)
+}
+
+//GenerateName is same as `MarkovChain.GenerateName`
+func (r *CompiledChain) GenerateName(ntokens int) (string, error) {
+	return r.chain.GenerateName(ntokens)
+}
+
+//GenerateAnswer is same as `MarkovChain.GenerateAnswer`
+func (r *CompiledChain) GenerateAnswer(message string, nwords int) (string, error) {
+	return r.chain.GenerateAnswer(message, nwords)
+}
+
+//GenerateSentenceOpts is same as `MarkovChain.GenerateSentenceOpts`
+func (r *CompiledChain) GenerateSentenceOpts(opts GenerateOptions) (string, error) {
+	return r.chain.GenerateSentenceOpts(opts)
+}
+
+//GenerateAnswerOpts is same as `MarkovChain.GenerateAnswerOpts`
+func (r *CompiledChain) GenerateAnswerOpts(message string, opts GenerateOptions) (string, error) {
+	return r.chain.GenerateAnswerOpts(message, opts)
+}
+
+//GenerateSentenceResult is same as `MarkovChain.GenerateSentenceResult`
+func (r *CompiledChain) GenerateSentenceResult(opts GenerateOptions) Result {
+	return r.chain.GenerateSentenceResult(opts)
+}
+
+//GenerateAnswerResult is same as `MarkovChain.GenerateAnswerResult`
+func (r *CompiledChain) GenerateAnswerResult(message string, opts GenerateOptions) Result {
+	return r.chain.GenerateAnswerResult(message, opts)
+}
+
+//StreamSentence is same as `MarkovChain.StreamSentence`
+func (r *CompiledChain) StreamSentence(opts GenerateOptions, yield func(token string) bool) Result {
+	return r.chain.StreamSentence(opts, yield)
+}
+
+//StreamAnswer is same as `MarkovChain.StreamAnswer`
+func (r *CompiledChain) StreamAnswer(message string, opts GenerateOptions, yield func(token string) bool) Result {
+	return r.chain.StreamAnswer(message, opts, yield)
+}
+
+//JoinTokens is same as `MarkovChain.JoinTokens`
+func (r *CompiledChain) JoinTokens(tokens []string) string {
+	return r.chain.JoinTokens(tokens)
+}
+
+//GenerateSentenceExplain is same as `MarkovChain.GenerateSentenceExplain`, sources of words are always NOSOURCE
+func (r *CompiledChain) GenerateSentenceExplain(opts GenerateOptions) (string, []Span, error) {
+	return r.chain.GenerateSentenceExplain(opts)
+}
+
+//GenerateAnswerExplain is same as `MarkovChain.GenerateAnswerExplain`, sources of words are always NOSOURCE
+func (r *CompiledChain) GenerateAnswerExplain(message string, opts GenerateOptions) (string, []Span, error) {
+	return r.chain.GenerateAnswerExplain(message, opts)
+}
+
+//BeamSearch is same as `MarkovChain.BeamSearch`
+func (r *CompiledChain) BeamSearch(start string, k int, nwords int) ([]Beam, error) {
+	return r.chain.BeamSearch(start, k, nwords)
+}
+
+//Score is same as `MarkovChain.Score`
+func (r *CompiledChain) Score(text string) (TextScore, error) {
+	return r.chain.Score(text)
+}
+
+//Perplexity is same as `MarkovChain.Perplexity`
+func (r *CompiledChain) Perplexity(textBlocks []string) (float64, error) {
+	return r.chain.Perplexity(textBlocks)
+}
+
+//Predict is same as `MarkovChain.Predict`
+func (r *CompiledChain) Predict(prefixWords []string, k int) ([]Prediction, error) {
+	return r.chain.Predict(prefixWords, k)
+}
+
+//Close release file of chain opened by `OpenCompiledChain`. Chain must not be used after closing.
+func (r *CompiledChain) Close() error {
+	if r.store.unmap == nil {
+		return nil
+	}
+	err := r.store.unmap()
+	r.store.unmap = nil
+	return err
+}
@@ -0,0 +1,306 @@
+package xrich
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"unsafe"
+)
+
+//compiledMagic is header of file of compiled chain, last byte is version of format
+const compiledMagic = "xrichc\x00\x02"
+
+//compiledHeaderSize is size of magic and header fields: order, flags, number of words, prefixes, transitions,
+//size of vocabulary, placeholder mode and number of values of placeholders
+const compiledHeaderSize = len(compiledMagic) + 8*4
+
+//WriteTo write chain to `w` in format which is read by `OpenCompiledChain` and `ReadCompiledChain`.
+//All numbers are little-endian 32-bit aligned to 4 bytes, so file can be memory-mapped.
+func (r *CompiledChain) WriteTo(w io.Writer) (int64, error) {
+	s := r.store
+	bw := bufio.NewWriter(w)
+	var n int64
+	write := func(data interface{}) error {
+		if err := binary.Write(bw, binary.LittleEndian, data); err != nil {
+			return err
+		}
+		n += int64(binary.Size(data))
+		return nil
+	}
+
+	var flags uint32
+	if r.chain.chars {
+		flags |= 1
+	}
+	if r.chain.compound {
+		flags |= 2
+	}
+	if r.chain.typography {
+		flags |= 4
+	}
+	ends := make([]uint32, len(s.words))
+	var vocabSize uint32
+	for i, w := range s.words {
+		vocabSize += uint32(len(w))
+		ends[i] = vocabSize
+	}
+	// values of placeholders are pairs of index of placeholder and id of value in vocabulary
+	var mode uint32
+	seen := make([]uint32, len(placeholderPatterns))
+	var values []uint32
+	if ph := s.placeholders; ph != nil {
+		mode = uint32(ph.mode)
+		for i, p := range placeholderPatterns {
+			seen[i] = uint32(ph.seen[p.token])
+			for _, v := range ph.values[p.token] {
+				values = append(values, uint32(i), s.ids[v])
+			}
+		}
+	}
+	header := []uint32{uint32(s.order), flags, uint32(len(s.words)), uint32(len(s.keys)), uint32(len(s.next)), vocabSize,
+		mode, uint32(len(values) / 2)}
+	if err := write([]byte(compiledMagic)); err != nil {
+		return n, err
+	}
+	if err := write(header); err != nil {
+		return n, err
+	}
+	if err := write(ends); err != nil {
+		return n, err
+	}
+	for _, w := range s.words {
+		if err := write([]byte(w)); err != nil {
+			return n, err
+		}
+	}
+	if err := write(make([]byte, padding(int(vocabSize)))); err != nil {
+		return n, err
+	}
+	for _, a := range [][]uint32{s.prefixes, s.keys, s.offsets, s.next, s.counts} {
+		if err := write(a); err != nil {
+			return n, err
+		}
+	}
+	if err := write(s.probs); err != nil {
+		return n, err
+	}
+	if err := write(s.aliases); err != nil {
+		return n, err
+	}
+	if err := write(seen); err != nil {
+		return n, err
+	}
+	if err := write(values); err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+//padding return number of bytes which align size `n` to 4 bytes
+func padding(n int) int {
+	return (4 - n%4) % 4
+}
+
+//ReadCompiledChain read chain written by `CompiledChain.WriteTo` into memory.
+//Words of messages are matched by CaseNormalizer until other normalizer is set.
+func ReadCompiledChain(rd io.Reader) (*CompiledChain, error) {
+	data, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	return parseCompiledChain(data)
+}
+
+//OpenCompiledChain memory-map file of chain written by `CompiledChain.WriteTo`, so chain is not loaded into memory.
+//File is read into memory on systems without memory mapping. Chain must be closed after use.
+func OpenCompiledChain(path string) (*CompiledChain, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(compiledHeaderSize) || info.Size() > math.MaxInt32 {
+		return nil, ErrCorrupted
+	}
+	data, unmap, err := mmapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	c, err := parseCompiledChain(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	c.store.unmap = unmap
+	return c, nil
+}
+
+//parseCompiledChain return chain which refer to arrays of `data` without copying if it is possible
+func parseCompiledChain(data []byte) (*CompiledChain, error) {
+	if len(data) < compiledHeaderSize || string(data[:len(compiledMagic)]) != compiledMagic {
+		return nil, ErrCorrupted
+	}
+	header := make([]uint32, 8)
+	for i := range header {
+		header[i] = binary.LittleEndian.Uint32(data[len(compiledMagic)+4*i:])
+	}
+	order, flags, nwords, nprefixes, ntransitions, vocabSize := int(header[0]), header[1], int(header[2]), int(header[3]), int(header[4]), int(header[5])
+	mode, nvalues := PlaceholderMode(header[6]), int(header[7])
+	if order < 1 || order > MAXNPREF {
+		return nil, ErrCorrupted
+	}
+	size := compiledHeaderSize + 4*nwords + vocabSize + padding(vocabSize) +
+		4*(nprefixes*order+nprefixes+nprefixes+1) + 4*4*ntransitions + 4*len(placeholderPatterns) + 4*2*nvalues
+	if nwords < 0 || nprefixes < 0 || ntransitions < 0 || vocabSize < 0 || nvalues < 0 || size != len(data) {
+		return nil, ErrCorrupted
+	}
+
+	s := &compiledStore{order: order, ids: make(map[string]uint32, nwords)}
+	off := compiledHeaderSize
+	next := func(n int) []uint32 {
+		a := uint32s(data[off : off+4*n])
+		off += 4 * n
+		return a
+	}
+	ends := next(nwords)
+	vocab := data[off : off+vocabSize]
+	off += vocabSize + padding(vocabSize)
+	start := uint32(0)
+	for i, end := range ends {
+		if end < start || end > uint32(vocabSize) {
+			return nil, ErrCorrupted
+		}
+		w := string(vocab[start:end])
+		s.words = append(s.words, w)
+		s.ids[w] = uint32(i)
+		start = end
+	}
+	s.prefixes = next(nprefixes * order)
+	s.keys = next(nprefixes)
+	s.offsets = next(nprefixes + 1)
+	s.next = next(ntransitions)
+	s.counts = next(ntransitions)
+	s.probs = float32s(next(ntransitions))
+	s.aliases = next(ntransitions)
+	seen := next(len(placeholderPatterns))
+	values := next(2 * nvalues)
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	ph, err := parsePlaceholders(mode, seen, values, s.words)
+	if err != nil {
+		return nil, err
+	}
+	s.placeholders = ph
+
+	return newCompiledChain(s, flags&1 != 0, flags&2 != 0, flags&4 != 0, CaseNormalizer{}, nil, nopLogger{})
+}
+
+//parsePlaceholders return placeholders of mode `mode` with numbers of seen values `seen` by index of placeholder
+//and pairs of index of placeholder and id of value in vocabulary `words`. Return nil if placeholders are off.
+func parsePlaceholders(mode PlaceholderMode, seen []uint32, values []uint32, words []string) (*placeholders, error) {
+	if mode == PlaceholdersOff {
+		for _, n := range seen {
+			if n != 0 {
+				return nil, ErrCorrupted
+			}
+		}
+		if len(values) > 0 {
+			return nil, ErrCorrupted
+		}
+		return nil, nil
+	}
+	if mode != PlaceholdersDrop && mode != PlaceholdersFill {
+		return nil, ErrCorrupted
+	}
+	ph := &placeholders{mode: mode, values: make(map[string][]string), seen: make(map[string]int)}
+	for i := 0; i < len(values); i += 2 {
+		if values[i] >= uint32(len(placeholderPatterns)) || values[i+1] >= uint32(len(words)) {
+			return nil, ErrCorrupted
+		}
+		token := placeholderPatterns[values[i]].token
+		ph.values[token] = append(ph.values[token], words[values[i+1]])
+	}
+	// values of placeholder are ring of most recent values, so its position is taken from number of seen values
+	for i, p := range placeholderPatterns {
+		n := int(seen[i])
+		if n > 0 {
+			ph.seen[p.token] = n
+		}
+		if n > maxPlaceholderValues {
+			n = maxPlaceholderValues
+		}
+		if len(ph.values[p.token]) != n {
+			return nil, ErrCorrupted
+		}
+	}
+	return ph, nil
+}
+
+//validate check that references of arrays are in range, so corrupted file can not cause panic on generation
+func (r *compiledStore) validate() error {
+	nwords := uint32(len(r.words))
+	nprefixes := uint32(len(r.keys))
+	for _, id := range r.prefixes {
+		if id >= nwords {
+			return ErrCorrupted
+		}
+	}
+	for _, i := range r.keys {
+		if i >= nprefixes {
+			return ErrCorrupted
+		}
+	}
+	if r.offsets[0] != 0 || r.offsets[nprefixes] != uint32(len(r.next)) {
+		return ErrCorrupted
+	}
+	for i := uint32(0); i < nprefixes; i++ {
+		lo, hi := r.offsets[i], r.offsets[i+1]
+		if hi <= lo {
+			return ErrCorrupted
+		}
+		for j := lo; j < hi; j++ {
+			if r.next[j] >= nwords || r.aliases[j] >= hi-lo {
+				return ErrCorrupted
+			}
+		}
+	}
+	return nil
+}
+
+//isLittleEndian is true if numbers of host are little-endian
+var isLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+//uint32s return little-endian numbers of `data`. Numbers refer to `data` if it is possible and are copied otherwise.
+func uint32s(data []byte) []uint32 {
+	n := len(data) / 4
+	if n == 0 {
+		return nil
+	}
+	if isLittleEndian && uintptr(unsafe.Pointer(&data[0]))%4 == 0 {
+		return unsafe.Slice((*uint32)(unsafe.Pointer(&data[0])), n)
+	}
+	a := make([]uint32, n)
+	for i := range a {
+		a[i] = binary.LittleEndian.Uint32(data[4*i:])
+	}
+	return a
+}
+
+//float32s reinterpret bits of numbers `a` as float32 numbers
+func float32s(a []uint32) []float32 {
+	if len(a) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*float32)(unsafe.Pointer(&a[0])), len(a))
+}
@@ -0,0 +1,253 @@
+package xrich
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile1(t *testing.T) {
+	ss := []string{"a b c b", "b c d"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	cc, err := c.Compile()
+	if !assert.NoError(t, err) {
+		return
+	}
+	cc.SetGeneratePolicy(testGeneratePolicy{})
+	assert.Equal(t, len(c.keys), cc.Len())
+	assert.Empty(t, cc.chain.keys)
+	assert.Empty(t, cc.chain.index)
+	assert.Equal(t, len(c.index["b"]), cc.chain.indexLen("b"))
+
+	s, err := cc.GenerateSentence(6)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c b . a", s)
+	s, err = cc.GenerateAnswer("b", 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "b c b", s)
+	s1, err := c.Score("a b c d")
+	assert.NoError(t, err)
+	s2, err := cc.Score("a b c d")
+	assert.NoError(t, err)
+	assert.InDelta(t, s1.LogProb, s2.LogProb, 1e-9)
+}
+
+func TestCompile2(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	cc, err := c.Compile()
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2}
+	rnd := rand.New(rand.NewSource(1))
+	n := 0
+	for i := 0; i < 3000; i++ {
+		s, prob, ok := cc.store.sampleSuffix(p, rnd)
+		assert.True(t, ok)
+		assert.InDelta(t, c.transitionProb(p, s.word), prob, 1e-9)
+		if s.word == "c" {
+			n++
+		}
+	}
+	assert.InDelta(t, 2000, n, 100)
+	assert.Equal(t, c.transitions(p), cc.store.transitionsOf(p))
+	_, _, ok := cc.store.sampleSuffix(Prefix{words: [MAXNPREF]string{"x", "b"}, n: 2}, rnd)
+	assert.False(t, ok)
+}
+
+func TestCompileFilter1(t *testing.T) {
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build([]string{"a b c", "a b d"}))
+	f := NewContentFilter()
+	f.BlockWords("c")
+	c.SetContentFilter(f)
+	cc, err := c.Compile()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// compiled chain keeps filter of source chain and steers away from blocked suffixes
+	cc.SetGeneratePolicy(NewRandomGeneratePolicy(1))
+	for i := 0; i < 20; i++ {
+		s, err := cc.GenerateAnswer("a", 5)
+		assert.NoError(t, err)
+		assert.Equal(t, "a b d", s)
+	}
+	assert.NoError(t, f.BlockPattern(`b d`))
+	_, err = cc.GenerateAnswer("a", 5)
+	assert.Equal(t, ErrBlocked, err)
+
+	cc.SetContentFilter(nil)
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		s, err := cc.GenerateAnswer("a", 5)
+		assert.NoError(t, err)
+		seen[s] = true
+	}
+	assert.Equal(t, map[string]bool{"a b c": true, "a b d": true}, seen)
+}
+
+func TestCompileFile1(t *testing.T) {
+	ss := []string{"a b c b", "b c d"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	cc, err := c.Compile()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var buf bytes.Buffer
+	n, err := cc.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	assert.Equal(t, 0, buf.Len()%4)
+
+	path := filepath.Join(t.TempDir(), "chain.xrc")
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	mc, err := OpenCompiledChain(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer mc.Close()
+	rc, err := ReadCompiledChain(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, x := range []*CompiledChain{mc, rc} {
+		x.SetGeneratePolicy(testGeneratePolicy{})
+		assert.Equal(t, cc.store.words, x.store.words)
+		assert.Equal(t, cc.store.probs, x.store.probs)
+		s, err := x.GenerateSentence(6)
+		assert.NoError(t, err)
+		assert.Equal(t, "a b c b . a", s)
+	}
+
+	data := buf.Bytes()
+	_, err = ReadCompiledChain(bytes.NewReader(data[:len(data)-4]))
+	assert.Equal(t, ErrCorrupted, err)
+	// last alias is followed by numbers of seen values of placeholders
+	data[len(data)-4-4*len(placeholderPatterns)] = 0xff
+	_, err = ReadCompiledChain(bytes.NewReader(data))
+	assert.Equal(t, ErrCorrupted, err)
+}
+
+func TestCompilePlaceholders1(t *testing.T) {
+	ss := []string{"see 42 dogs now", "see 7 cats now"}
+	for _, mode := range []PlaceholderMode{PlaceholdersDrop, PlaceholdersFill} {
+		c := NewMarkovChain()
+		c.SetGeneratePolicy(testGeneratePolicy{})
+		c.SetPlaceholders(mode)
+		assert.NoError(t, c.Build(ss))
+		cc, err := c.Compile()
+		if !assert.NoError(t, err) {
+			return
+		}
+		var buf bytes.Buffer
+		_, err = cc.WriteTo(&buf)
+		assert.NoError(t, err)
+		rc, err := ReadCompiledChain(bytes.NewReader(buf.Bytes()))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, c.placeholders, rc.store.placeholders)
+
+		// compiled chain resolves placeholders like source chain
+		expected, err := c.GenerateSentence(6)
+		assert.NoError(t, err)
+		assert.NotContains(t, expected, PlaceholderNumber)
+		for _, x := range []*CompiledChain{cc, rc} {
+			x.SetGeneratePolicy(testGeneratePolicy{})
+			s, err := x.GenerateSentence(6)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, s)
+		}
+	}
+}
+
+func TestBuildAlias(t *testing.T) {
+	counts := []uint32{5, 1, 3, 1}
+	probs := make([]float32, len(counts))
+	aliases := make([]uint32, len(counts))
+	buildAlias(counts, probs, aliases)
+	p := make([]float64, len(counts))
+	for i := range counts {
+		p[i] += float64(probs[i]) / 4
+		p[aliases[i]] += (1 - float64(probs[i])) / 4
+	}
+	for i, c := range counts {
+		assert.InDelta(t, float64(c)/10, p[i], 1e-6)
+	}
+}
+
+//benchTextBlocks return text blocks of random words from vocabulary of size `nvocab`
+func benchTextBlocks(nblocks int, nvocab int) []string {
+	rnd := rand.New(rand.NewSource(1))
+	ss := make([]string, nblocks)
+	for i := range ss {
+		var b bytes.Buffer
+		for j := 0; j < 20; j++ {
+			// skewed distribution of words
+			fmt.Fprintf(&b, "%s ", benchWord(rnd.Intn(rnd.Intn(nvocab)+1)))
+		}
+		ss[i] = b.String()
+	}
+	return ss
+}
+
+//benchWord return word of letters for number `n` because digits are removed from text blocks
+func benchWord(n int) string {
+	w := []byte{'w'}
+	for {
+		w = append(w, byte('a'+n%26))
+		n /= 26
+		if n == 0 {
+			return string(w)
+		}
+	}
+}
+
+func BenchmarkGenerateSentence(b *testing.B) {
+	c := NewMarkovChain()
+	c.Build(benchTextBlocks(10000, 100))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.GenerateSentence(MAXGEN)
+	}
+}
+
+func BenchmarkCompiledGenerateSentence(b *testing.B) {
+	c := NewMarkovChain()
+	c.Build(benchTextBlocks(10000, 100))
+	cc, _ := c.Compile()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cc.GenerateSentence(MAXGEN)
+	}
+}
+
+func BenchmarkGenerateAnswer(b *testing.B) {
+	c := NewMarkovChain()
+	c.Build(benchTextBlocks(10000, 100))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.GenerateAnswerOpts("wb wc wd", GenerateOptions{StopAtEnd: true})
+	}
+}
+
+func BenchmarkCompiledGenerateAnswer(b *testing.B) {
+	c := NewMarkovChain()
+	c.Build(benchTextBlocks(10000, 100))
+	cc, _ := c.Compile()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cc.GenerateAnswerOpts("wb wc wd", GenerateOptions{StopAtEnd: true})
+	}
+}
@@ -0,0 +1,60 @@
+package xrich
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	//ErrEmptyChain is returned when chain has no transitions
+	ErrEmptyChain = errors.New("xrich: chain is empty")
+	//ErrNoText is returned when no sentence was finished within limits of generation
+	ErrNoText = errors.New("xrich: no text generated")
+	//ErrNoAnswer is returned when no word of message triggers answer
+	ErrNoAnswer = errors.New("xrich: no answer for message")
+	//ErrNoTokens is returned when text has no tokens to evaluate chain on
+	ErrNoTokens = errors.New("xrich: no tokens in text")
+	//ErrInvalidOrder is returned when prefix length is out of range [1, MAXNPREF]
+	ErrInvalidOrder = fmt.Errorf("xrich: order must be in range [1, %d]", MAXNPREF)
+	//ErrCorrupted is returned when stored data of chain can not be decoded
+	ErrCorrupted = errors.New("xrich: corrupted data")
+	//ErrIncompatible is returned when chains with different order or kind of tokens are merged
+	ErrIncompatible = errors.New("xrich: chains are incompatible")
+	//ErrRepeated is returned when only recently generated texts were generated and novelty policy rejects them
+	ErrRepeated = errors.New("xrich: only repeated text generated")
+	//ErrBlocked is returned when only texts with content blocked by content filter were generated
+	ErrBlocked = errors.New("xrich: only blocked text generated")
+)
+
+//ScanError is returned when text can not be split into tokens
+type ScanError struct {
+	Block int // index of text block in argument of `Build` or -1 for other texts
+	Err   error
+}
+
+func (e *ScanError) Error() string {
+	if e.Block < 0 {
+		return fmt.Sprintf("xrich: error scanning text: %v", e.Err)
+	}
+	return fmt.Sprintf("xrich: error scanning text block %d: %v", e.Block, e.Err)
+}
+
+//Unwrap return underlying error of scanner
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+//StoreError is returned when state store of chain failed
+type StoreError struct {
+	Op  string // operation of store: get, append or range
+	Err error
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("xrich: state store %s: %v", e.Op, e.Err)
+}
+
+//Unwrap return underlying error of store
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
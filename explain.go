@@ -0,0 +1,35 @@
+package xrich
+
+//Span is sequence of generated words taken from one source text block
+type Span struct {
+	Source int // index of text block counted over all calls of `Build` or NOSOURCE
+	Words  []string
+}
+
+//spans group consecutive words from same source text block into spans
+func spans(sx []Suffix) []Span {
+	var res []Span
+	for _, s := range sx {
+		n := len(res)
+		if n > 0 && res[n-1].Source == int(s.src) {
+			res[n-1].Words = append(res[n-1].Words, s.word)
+			continue
+		}
+		res = append(res, Span{Source: int(s.src), Words: []string{s.word}})
+	}
+	return res
+}
+
+//GenerateSentenceExplain return generated text like `GenerateSentenceOpts` and source text blocks of its words.
+//Sources are known only if chain was built with enabled provenance.
+func (r *MarkovChain) GenerateSentenceExplain(opts GenerateOptions) (string, []Span, error) {
+	res := r.GenerateSentenceResult(opts)
+	return res.Text, res.Spans, res.Err
+}
+
+//GenerateAnswerExplain return generated answer like `GenerateAnswerOpts` and source text blocks of its words.
+//Words of message which start answer have source NOSOURCE.
+func (r *MarkovChain) GenerateAnswerExplain(message string, opts GenerateOptions) (string, []Span, error) {
+	res := r.GenerateAnswerResult(message, opts)
+	return res.Text, res.Spans, res.Err
+}
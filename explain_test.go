@@ -0,0 +1,41 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain1(t *testing.T) {
+	ss := []string{"a b c", "x b d"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	c.SetProvenance(true)
+	assert.NoError(t, c.Build(ss))
+	s, sp, err := c.GenerateSentenceExplain(GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c", s)
+	assert.Equal(t, []Span{{0, []string{"a", "b", "c"}}}, sp)
+}
+
+func TestExplain2(t *testing.T) {
+	ss := []string{"a b c", "x b d"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	c.SetProvenance(true)
+	assert.NoError(t, c.Build(ss))
+	s, sp, err := c.GenerateAnswerExplain("x", GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "x b d", s)
+	assert.Equal(t, []Span{{NOSOURCE, []string{"x"}}, {1, []string{"b", "d"}}}, sp)
+}
+
+func TestExplain3(t *testing.T) {
+	ss := []string{"a b c"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	_, sp, err := c.GenerateSentenceExplain(GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []Span{{NOSOURCE, []string{"a", "b", "c"}}}, sp)
+}
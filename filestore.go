@@ -0,0 +1,362 @@
+package xrich
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+//fileMagic is header of file of FileStore, last byte is version of format
+const fileMagic = "xrich\x01"
+
+//maxRecordSize is limit of size of record which is used to detect corrupted records
+const maxRecordSize = 1 << 20
+
+//errTornRecord is returned by `readRecord` if file ends inside of record
+var errTornRecord = errors.New("xrich: torn record")
+
+//fileHead is position of suffixes of prefix in file
+type fileHead struct {
+	first int64 // offset of record which added prefix, it orders prefixes
+	last  int64 // offset of last record of prefix
+	count int   // number of records of prefix
+}
+
+//FileStore keep states transitions table in append-only file which persists between restarts.
+//Every suffix is stored in record which links to previous record of same prefix, only prefixes with position
+//of their first and last records are kept in memory, so memory does not grow with number of transitions but it still grows
+//with number of prefixes. Replaced and removed suffixes stay in file until `Compact` is called.
+//Last record written partially by crash is discarded on opening. FileStore is not safe for concurrent use.
+type FileStore struct {
+	path  string
+	f     *os.File
+	w     *bufio.Writer
+	size  int64 // size of file including buffered records
+	dirty bool  // buffer has records which are not written to file
+	heads map[Prefix]fileHead
+	buf   bytes.Buffer
+}
+
+//OpenFileStore open store in file `path` creating it if it does not exist.
+//Return ErrCorrupted if file is not a store file or record before last one is damaged, file is not changed then.
+func OpenFileStore(path string) (*FileStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r := &FileStore{path: path, f: f, heads: make(map[Prefix]fileHead)}
+	if err := r.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.w = bufio.NewWriter(f)
+	return r, nil
+}
+
+//load read positions of prefixes from file and truncate torn last record
+func (r *FileStore) load() error {
+	info, err := r.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := r.f.WriteString(fileMagic); err != nil {
+			return err
+		}
+		r.size = int64(len(fileMagic))
+		return nil
+	}
+
+	rd := bufio.NewReader(r.f)
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(rd, magic); err != nil || string(magic) != fileMagic {
+		return ErrCorrupted
+	}
+	r.size = int64(len(fileMagic))
+	for {
+		payload, err := readRecord(rd)
+		if err == io.EOF || err == errTornRecord {
+			break
+		}
+		var p Prefix
+		var sf Suffix
+		var prev int64
+		var ok bool
+		if err == nil {
+			prev, ok, err = decodeRecord(payload, &p, &sf)
+		}
+		if err == ErrCorrupted {
+			// damaged record is discarded only if it is last one, so it was written partially by crash
+			if _, perr := rd.Peek(1); perr == io.EOF {
+				break
+			}
+			return ErrCorrupted
+		}
+		if err != nil {
+			return err
+		}
+		h, known := r.heads[p]
+		switch {
+		case !ok:
+			delete(r.heads, p)
+		case known && prev < 0:
+			// suffixes of prefix were replaced
+			r.heads[p] = fileHead{first: h.first, last: r.size, count: 1}
+		case known:
+			r.heads[p] = fileHead{first: h.first, last: r.size, count: h.count + 1}
+		default:
+			r.heads[p] = fileHead{first: r.size, last: r.size, count: 1}
+		}
+		r.size += recordHeaderSize + int64(len(payload))
+	}
+
+	if r.size < info.Size() {
+		if err := r.f.Truncate(r.size); err != nil {
+			return err
+		}
+	}
+	_, err = r.f.Seek(r.size, io.SeekStart)
+	return err
+}
+
+//recordHeaderSize is size of length and checksum of record payload
+const recordHeaderSize = 8
+
+//readRecord return payload of next record of reader `rd`.
+//Return io.EOF at end of file, errTornRecord if file ends inside of record and ErrCorrupted if record is damaged.
+func readRecord(rd io.Reader) ([]byte, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(rd, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil, errTornRecord
+		}
+		return nil, err
+	}
+	size := binary.LittleEndian.Uint32(header[:4])
+	if size > maxRecordSize {
+		return nil, ErrCorrupted
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(rd, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTornRecord
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, ErrCorrupted
+	}
+	return payload, nil
+}
+
+//decodeRecord decode prefix and suffix of record into `p` and `s` and return offset of previous record of prefix or -1.
+//Return false if record has no suffix, such record removes prefix.
+func decodeRecord(payload []byte, p *Prefix, s *Suffix) (int64, bool, error) {
+	rd := bytes.NewReader(payload)
+	prev, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return 0, false, ErrCorrupted
+	}
+	if err := p.decode(rd); err != nil {
+		return 0, false, err
+	}
+	if rd.Len() == 0 {
+		return int64(prev) - 1, false, nil
+	}
+	if err := s.decode(rd); err != nil {
+		return 0, false, err
+	}
+	return int64(prev) - 1, true, nil
+}
+
+//Get return suffixes of prefix `p` or nil if prefix is unknown
+func (r *FileStore) Get(p Prefix) ([]Suffix, error) {
+	h, ok := r.heads[p]
+	if !ok {
+		return nil, nil
+	}
+	if r.dirty {
+		if err := r.w.Flush(); err != nil {
+			return nil, err
+		}
+		r.dirty = false
+	}
+
+	sx := make([]Suffix, h.count)
+	off := h.last
+	for i := h.count - 1; i >= 0; i-- {
+		if off < 0 {
+			return nil, ErrCorrupted
+		}
+		payload, err := readRecord(io.NewSectionReader(r.f, off, r.size-off))
+		if err == io.EOF || err == errTornRecord {
+			return nil, ErrCorrupted
+		}
+		if err != nil {
+			return nil, err
+		}
+		var rp Prefix
+		var ok bool
+		if off, ok, err = decodeRecord(payload, &rp, &sx[i]); err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrCorrupted
+		}
+	}
+	return sx, nil
+}
+
+//Append add suffix `s` to suffixes of prefix `p` and return true if prefix was unknown
+func (r *FileStore) Append(p Prefix, s Suffix) (bool, error) {
+	h, ok := r.heads[p]
+	prev := int64(-1)
+	if ok {
+		prev = h.last
+	}
+	off, err := r.writeRecord(p, &s, prev)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		h.first = off
+	}
+	r.heads[p] = fileHead{first: h.first, last: off, count: h.count + 1}
+	return !ok, nil
+}
+
+//Set replace suffixes of prefix `p` by `sx`, prefix is removed if `sx` is empty
+func (r *FileStore) Set(p Prefix, sx []Suffix) error {
+	h, ok := r.heads[p]
+	if len(sx) == 0 {
+		if !ok {
+			return nil
+		}
+		if _, err := r.writeRecord(p, nil, -1); err != nil {
+			return err
+		}
+		delete(r.heads, p)
+		return nil
+	}
+
+	// first record does not link to previous records, so it starts new list of suffixes
+	prev := int64(-1)
+	for i := range sx {
+		off, err := r.writeRecord(p, &sx[i], prev)
+		if err != nil {
+			return err
+		}
+		if i == 0 && !ok {
+			h.first = off
+		}
+		prev = off
+	}
+	r.heads[p] = fileHead{first: h.first, last: prev, count: len(sx)}
+	return nil
+}
+
+//writeRecord write record of prefix `p` and suffix `s` linked to record at offset `prev` and return offset of record.
+//Record without suffix is written if `s` is nil.
+func (r *FileStore) writeRecord(p Prefix, s *Suffix, prev int64) (int64, error) {
+	r.buf.Reset()
+	r.buf.Write(make([]byte, recordHeaderSize))
+	var vb [binary.MaxVarintLen64]byte
+	r.buf.Write(vb[:binary.PutUvarint(vb[:], uint64(prev+1))])
+	p.encode(&r.buf)
+	if s != nil {
+		s.encode(&r.buf)
+	}
+	record := r.buf.Bytes()
+	payload := record[recordHeaderSize:]
+	binary.LittleEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:recordHeaderSize], crc32.ChecksumIEEE(payload))
+
+	if _, err := r.w.Write(record); err != nil {
+		return 0, err
+	}
+	r.dirty = true
+	off := r.size
+	r.size += int64(len(record))
+	return off, nil
+}
+
+//Len return number of prefixes
+func (r *FileStore) Len() int {
+	return len(r.heads)
+}
+
+//Range call `f` for every prefix in order of addition until `f` return false.
+//Prefixes are sorted by offsets of records which added them on every call.
+func (r *FileStore) Range(f func(p Prefix) bool) error {
+	keys := make([]orderedPrefix, 0, len(r.heads))
+	for p, h := range r.heads {
+		keys = append(keys, orderedPrefix{p, h.first})
+	}
+	rangeOrdered(keys, f)
+	return nil
+}
+
+//Compact rewrite file keeping only current suffixes of prefixes, so space of replaced and removed suffixes is freed.
+//Suffixes of every prefix are written together, so they are read faster.
+func (r *FileStore) Compact() error {
+	tmp := r.path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c, err := OpenFileStore(tmp)
+	if err != nil {
+		return err
+	}
+	var rerr error
+	err = r.Range(func(p Prefix) bool {
+		var sx []Suffix
+		if sx, rerr = r.Get(p); rerr != nil {
+			return false
+		}
+		rerr = c.Set(p, sx)
+		return rerr == nil
+	})
+	if err == nil {
+		err = rerr
+	}
+	if err == nil {
+		err = c.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, r.path)
+	}
+	if err != nil {
+		c.Close()
+		os.Remove(tmp)
+		return err
+	}
+	r.f.Close()
+	c.path = r.path
+	*r = *c
+	return nil
+}
+
+//Sync write buffered records to file and commit file to disk
+func (r *FileStore) Sync() error {
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	r.dirty = false
+	return r.f.Sync()
+}
+
+//Close write buffered records to file and close it
+func (r *FileStore) Close() error {
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
@@ -0,0 +1,143 @@
+package xrich
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+//personalPatterns detect personal data: e-mails, URLs and phone numbers.
+//Phone number has at least 7 digits in few groups like "+7 (999) 123-45-67" or "555.123.4567",
+//so versions, IP addresses and lists of small numbers are not blocked.
+var personalPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`),
+	regexp.MustCompile(`(?i)(?:https?://|www\.)\S+`),
+	regexp.MustCompile(`(?:^|[^\w+(])\+?(?:\d{1,3}[\s.-]?)?(?:\(\d{3,5}\)|\d{3,5})[\s.-]?\d{2,3}(?:[\s.-]?\d{2}){1,2}\b`),
+}
+
+//filterAttempts is max number of generations of text while it is blocked if novelty policy does not set it
+const filterAttempts = 5
+
+//ContentFilter detect blocked words and patterns in texts. Text blocks with blocked content are dropped by `Build`
+//or blocked content is removed from them if Mask is set. Generation avoids blocked words and rejects texts with blocked content.
+type ContentFilter struct {
+	Mask     bool // remove blocked content from text blocks instead of dropping them
+	words    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+//NewContentFilter return filter which block nothing until words or patterns are added
+func NewContentFilter() *ContentFilter {
+	return &ContentFilter{words: make(map[string]bool)}
+}
+
+//BlockWords block words `words`, words are matched case-insensitive
+func (r *ContentFilter) BlockWords(words ...string) {
+	for _, w := range words {
+		r.words[strings.ToLower(w)] = true
+	}
+}
+
+//BlockPattern block text matched by regular expression `expr`
+func (r *ContentFilter) BlockPattern(expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	r.patterns = append(r.patterns, re)
+	return nil
+}
+
+//BlockPersonalData block e-mails, URLs and phone numbers
+func (r *ContentFilter) BlockPersonalData() {
+	r.patterns = append(r.patterns, personalPatterns...)
+}
+
+//BlockedWord return true if word `word` is blocked
+func (r *ContentFilter) BlockedWord(word string) bool {
+	return r.words[strings.ToLower(word)]
+}
+
+//Blocked return true if text `text` has blocked word or matches blocked pattern
+func (r *ContentFilter) Blocked(text string) bool {
+	for _, re := range r.patterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	blocked := false
+	r.scanWords(text, func(start int, end int) {
+		blocked = blocked || r.BlockedWord(text[start:end])
+	})
+	return blocked
+}
+
+//MaskText return text `text` without blocked patterns and words
+func (r *ContentFilter) MaskText(text string) string {
+	for _, re := range r.patterns {
+		text = re.ReplaceAllString(text, " ")
+	}
+	var b strings.Builder
+	last := 0
+	r.scanWords(text, func(start int, end int) {
+		if r.BlockedWord(text[start:end]) {
+			b.WriteString(text[last:start])
+			last = end
+		}
+	})
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+//scanWords call `f` with bounds of every word of text `text`, word is sequence of letters and digits
+func (r *ContentFilter) scanWords(text string, f func(start int, end int)) {
+	start := -1
+	for i, c := range text {
+		isWordRune := unicode.IsLetter(c) || unicode.IsDigit(c)
+		switch {
+		case isWordRune && start < 0:
+			start = i
+		case !isWordRune && start >= 0:
+			f(start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		f(start, len(text))
+	}
+}
+
+//middleware return middleware which remove candidates with blocked words
+func (r *ContentFilter) middleware() Middleware {
+	return FilterWords(func(word string) bool {
+		return !r.BlockedWord(word)
+	})
+}
+
+//SetContentFilter set filter of blocked content which is applied to text blocks by `Build` and to generated texts.
+//Nil filter disables filtering.
+func (r *MarkovChain) SetContentFilter(f *ContentFilter) {
+	r.filter = f
+}
+
+//tokenizeBlock split text block `text` into tokens like `tokenize` after content filter of chain is applied
+//and return values of placeholders of text block which must be remembered.
+//Return false if text block is dropped by filter.
+func (r *MarkovChain) tokenizeBlock(text string) ([]string, []placeholderValue, bool, error) {
+	if r.filter != nil && r.filter.Mask {
+		text = r.filter.MaskText(text)
+	} else if r.blocked(text) {
+		return nil, nil, false, nil
+	}
+	var values []placeholderValue
+	if r.placeholders != nil {
+		text, values = r.placeholders.replace(text)
+	}
+	words, err := r.tokenize(text)
+	return words, values, true, err
+}
+
+//blocked return true if text `text` is blocked by content filter of chain
+func (r *MarkovChain) blocked(text string) bool {
+	return r.filter != nil && r.filter.Blocked(text)
+}
@@ -0,0 +1,78 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentFilter1(t *testing.T) {
+	f := NewContentFilter()
+	f.BlockWords("Bad")
+	assert.NoError(t, f.BlockPattern(`wor[sd]e`))
+	assert.Error(t, f.BlockPattern(`(`))
+	f.BlockPersonalData()
+
+	assert.True(t, f.BlockedWord("bad"))
+	assert.True(t, f.Blocked("so BAD, really"))
+	assert.False(t, f.Blocked("badly done"))
+	assert.True(t, f.Blocked("even worse"))
+	assert.True(t, f.Blocked("write to john.doe@example.com"))
+	assert.True(t, f.Blocked("see https://example.com/page"))
+	assert.True(t, f.Blocked("call +1 (555) 123-4567"))
+	assert.True(t, f.Blocked("звони 8 (999) 123 45 67"))
+	assert.True(t, f.Blocked("tel 123-45-67"))
+	assert.False(t, f.Blocked("версия 1.2.3.4"))
+	assert.False(t, f.Blocked("1 2 3 4 5"))
+	assert.False(t, f.Blocked("host 192.168.1.1"))
+	assert.False(t, f.Blocked("in 2019 15 times"))
+	assert.False(t, f.Blocked("good text"))
+	assert.Equal(t, "so , really", f.MaskText("so bad, really"))
+	assert.Equal(t, "mail   now", f.MaskText("mail john@example.com now"))
+}
+
+func TestContentFilter2(t *testing.T) {
+	ss := []string{"a b c", "x bad y"}
+	f := NewContentFilter()
+	f.BlockWords("bad")
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	c.SetProvenance(true)
+	c.SetContentFilter(f)
+	assert.NoError(t, c.Build(ss))
+	_, err := c.GenerateAnswer("x", 5)
+	assert.Error(t, err)
+	assert.Equal(t, 2, c.nblocks)
+
+	// blocked words are removed from text blocks with mask
+	f.Mask = true
+	c = NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	c.SetContentFilter(f)
+	assert.NoError(t, c.BuildParallel(ss, 2))
+	s, err := c.GenerateAnswer("x", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "x y", s)
+}
+
+func TestContentFilter3(t *testing.T) {
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build([]string{"a b c", "a b d"}))
+	f := NewContentFilter()
+	f.BlockWords("c")
+	c.SetContentFilter(f)
+	s, err := c.GenerateAnswer("a", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b d", s)
+
+	// generated texts which match blocked pattern are rejected
+	assert.NoError(t, f.BlockPattern(`b d`))
+	_, err = c.GenerateSentence(5)
+	assert.Equal(t, ErrBlocked, err)
+	_, err = c.GenerateAnswer("a", 5)
+	assert.Equal(t, ErrBlocked, err)
+	res := c.GenerateSentenceResult(GenerateOptions{StopAtEnd: true})
+	assert.Equal(t, ErrBlocked, res.Err)
+	assert.Equal(t, StopBlocked, res.Stop)
+}
@@ -0,0 +1,203 @@
+package xrich
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+//GenerateOptions control length of generated text. Text is always cut on last end of sentence
+//so it never ends with unfinished phrase.
+type GenerateOptions struct {
+	MinWords     int  // min number of words before text can be stopped by StopAtEnd
+	MaxWords     int  // max number of words including separators between phrases, MAXGEN if zero
+	MaxChars     int  // max number of characters in text, unlimited if zero
+	MaxSentences int  // max number of sentences, unlimited if zero
+	StopAtEnd    bool // stop at first end of sentence after MinWords words
+}
+
+//isSentenceEnd return true if token `s` is punctuation which finish sentence like "." or "?!"
+func isSentenceEnd(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !isTerminator(c) {
+			return false
+		}
+	}
+	return true
+}
+
+//stop return true if generation with options `opts` should be stopped on end of sentence
+func (o GenerateOptions) stop(nwords int, nsentences int) bool {
+	if o.StopAtEnd && nwords >= o.MinWords {
+		return true
+	}
+	return o.MaxSentences > 0 && nsentences >= o.MaxSentences
+}
+
+//generated is text generated from chain
+type generated struct {
+	words   []Suffix
+	logProb float64
+	stop    StopReason
+}
+
+//generateText return words `head` followed by words generated from context `ctx` within limits of options `opts`.
+//Words are cut on last end of sentence or end of phrase. Words are empty if no sentence was finished.
+//If `emit` is not nil then every generated word is passed to it as soon as it is generated
+//and words are not cut, generation is stopped when `emit` return false.
+//Quotes and brackets are balanced if typography is enabled.
+func (r *MarkovChain) generateText(ctx *Context, head []string, opts GenerateOptions, emit func(s Suffix) bool) (res generated) {
+	maxWords := opts.MaxWords
+	if maxWords == 0 {
+		maxWords = MAXGEN
+	}
+
+	words := sourceless(head...)
+	// logProbs[i] is log-probability of first i words
+	logProbs := make([]float64, len(words)+1)
+	end := 0
+	nsentences := 0
+	var quotes quoteTracker
+	// limit of characters is checked before word is added, so streamed text does not exceed it
+	overLimit := func(s Suffix) bool {
+		return opts.MaxChars > 0 && utf8.RuneCountInString(r.join(suffixWords(append(words[:len(words):len(words)], s)))) > opts.MaxChars
+	}
+	res.stop = StopLength
+	// ended is set when generation is stopped on end of sentence, only terminators which continue it are added
+	ended := false
+	for i := len(head); i < maxWords; i++ {
+		s, ok := r.step(ctx)
+		if ended && (!ok || !isSentenceEnd(s.word)) {
+			break
+		}
+		if !ok {
+			res.stop = StopDeadEnd
+			break
+		}
+		logProb := logProbs[len(words)] + math.Log(ctx.prob)
+		if s.word == NONWORD {
+			if len(words) == len(head) {
+				// phrase is ended before any word was generated
+				if len(head) > 0 {
+					res.stop = StopPhraseEnd
+					break
+				}
+				continue
+			}
+			if end != len(words) {
+				end = len(words)
+				nsentences++
+			}
+			if opts.stop(len(words), nsentences) {
+				res.stop = StopPhraseEnd
+				break
+			}
+			if overLimit(sourceless(SEP)[0]) {
+				break
+			}
+			words = append(words, sourceless(SEP)...)
+			logProbs = append(logProbs, logProb)
+			if emit != nil && !emit(words[len(words)-1]) {
+				res.stop = StopConsumer
+				break
+			}
+			continue
+		}
+
+		if s, ok = r.resolvePlaceholder(s); !ok {
+			// probability of dropped placeholder is kept for next word
+			logProbs[len(words)] = logProb
+			continue
+		}
+		if overLimit(s) {
+			break
+		}
+		if r.typography && quotes.add(s.word) == quoteUnmatched {
+			// closing quote or bracket which was not opened is dropped
+			logProbs[len(words)] = logProb
+			continue
+		}
+		words = append(words, s)
+		logProbs = append(logProbs, logProb)
+		if emit != nil && !emit(s) {
+			res.stop = StopConsumer
+			break
+		}
+		if isSentenceEnd(s.word) {
+			// run of terminators like "?!" split into several tokens ends one sentence
+			if end != len(words)-1 {
+				nsentences++
+			}
+			end = len(words)
+			if !ended && opts.stop(len(words), nsentences) {
+				res.stop = StopSentenceEnd
+				ended = true
+			}
+		}
+	}
+
+	if emit != nil {
+		// streamed words can not be changed, so open quotes are closed after them
+		if r.typography && res.stop != StopConsumer {
+			for _, c := range quotes.closers() {
+				words = append(words, sourceless(c)...)
+				logProbs = append(logProbs, logProbs[len(logProbs)-1])
+				if !emit(words[len(words)-1]) {
+					res.stop = StopConsumer
+					break
+				}
+			}
+		}
+		end = len(words)
+	}
+	if end == 0 {
+		return generated{stop: res.stop}
+	}
+	res.words = r.balanceQuotes(words[:end])
+	res.logProb = logProbs[end]
+	return res
+}
+
+//generateSentence return text generated from first prefix with length controlled by options `opts`.
+//Words are passed to `emit` if it is not nil.
+//Streamed text is not generated again by novelty policy or content filter.
+func (r *MarkovChain) generateSentence(opts GenerateOptions, emit func(s Suffix) bool) generated {
+	r.policy.init(r)
+
+	generate := func() generated {
+		ctx := new(Context)
+		ctx.prefix = r.policy.findFirstPrefix(r)
+		return r.generateText(ctx, nil, opts, emit)
+	}
+	if emit != nil {
+		g := generate()
+		r.rememberText(g.words)
+		return g
+	}
+	return r.generateChecked(generate)
+}
+
+//GenerateSentenceOpts return generated text with length controlled by options `opts`.
+//Errors are same as in `GenerateSentenceResult`.
+func (r *MarkovChain) GenerateSentenceOpts(opts GenerateOptions) (string, error) {
+	res := r.GenerateSentenceResult(opts)
+	return res.Text, res.Err
+}
+
+//GenerateAnswerOpts return generated answer for text `message` with length controlled by options `opts`.
+//Words of message which start answer are counted in its length. Errors are same as in `GenerateAnswerResult`.
+func (r *MarkovChain) GenerateAnswerOpts(message string, opts GenerateOptions) (string, error) {
+	res := r.GenerateAnswerResult(message, opts)
+	return res.Text, res.Err
+}
+
+//answerGenerator return function which generate answer from prefix with length controlled by options `opts`
+func (r *MarkovChain) answerGenerator(opts GenerateOptions) func(prefix Prefix, from int) generated {
+	return func(prefix Prefix, from int) generated {
+		ctx := new(Context)
+		ctx.prefix = prefix
+		return r.generateText(ctx, prefix.words[from:prefix.n], opts, nil)
+	}
+}
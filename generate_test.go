@@ -0,0 +1,73 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateOpts1(t *testing.T) {
+	ss := []string{"a b c. d e", "f g"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	var s string
+	var err error
+	s, err = c.GenerateSentenceOpts(GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c .", s)
+	s, err = c.GenerateSentenceOpts(GenerateOptions{StopAtEnd: true, MinWords: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c . d e", s)
+	s, err = c.GenerateSentenceOpts(GenerateOptions{MaxSentences: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c . d e", s)
+}
+
+func TestGenerateOpts3(t *testing.T) {
+	ss := []string{"a b ?! c d . e f"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	res := c.GenerateSentenceResult(GenerateOptions{MaxSentences: 2})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, []string{"a", "b", "?", "!", "c", "d", "."}, res.Tokens)
+	assert.Equal(t, StopSentenceEnd, res.Stop)
+	res = c.GenerateSentenceResult(GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, []string{"a", "b", "?", "!"}, res.Tokens)
+}
+
+func TestGenerateOpts2(t *testing.T) {
+	ss := []string{"a b c. d e", "f g"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	var s string
+	var err error
+	s, err = c.GenerateSentenceOpts(GenerateOptions{MaxWords: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c .", s)
+	s, err = c.GenerateSentenceOpts(GenerateOptions{MaxChars: 8})
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c .", s)
+	_, err = c.GenerateSentenceOpts(GenerateOptions{MaxWords: 2})
+	assert.Equal(t, ErrNoText, err)
+}
+
+func TestAnswerOpts1(t *testing.T) {
+	ss := []string{"a b c. d e", "f g"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	var s string
+	var err error
+	s, err = c.GenerateAnswerOpts("d", GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "d e", s)
+	s, err = c.GenerateAnswerOpts("a", GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c .", s)
+	_, err = c.GenerateAnswerOpts("a", GenerateOptions{MaxWords: 3})
+	assert.Equal(t, ErrNoAnswer, err)
+}
@@ -0,0 +1,17 @@
+package xrich
+
+//Logger is structured logger used by MarkovChain. It is implemented by *zap.SugaredLogger.
+type Logger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+//nopLogger discard all messages
+type nopLogger struct{}
+
+func (nopLogger) Debugw(msg string, keysAndValues ...interface{}) {}
+func (nopLogger) Infow(msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Warnw(msg string, keysAndValues ...interface{})  {}
+func (nopLogger) Errorw(msg string, keysAndValues ...interface{}) {}
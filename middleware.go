@@ -0,0 +1,196 @@
+package xrich
+
+import "math/rand"
+
+//Candidate is word which can follow prefix in generated text, word NONWORD ends phrase
+type Candidate struct {
+	Word   string
+	Weight float64 // candidate is chosen in proportion to its weight, candidates with zero weight are not chosen
+}
+
+//Middleware change candidates `cs` of next word after words `prefix` before they are chosen by policy.
+//It can remove candidates (filter), change their weights (re-weighter) or replace them (fallback).
+//Middleware can modify slice `cs`.
+type Middleware func(prefix []string, cs []Candidate) []Candidate
+
+//ComposedGeneratePolicy choose elements by wrapped policy after candidates of next word are passed through middlewares
+type ComposedGeneratePolicy struct {
+	GeneratePolicy
+	middlewares []Middleware
+}
+
+//ComposeGeneratePolicy return policy `base` with middlewares `mws`. Candidates of next word are transitions of prefix
+//weighted by probabilities, they are passed through middlewares in order of arguments, every middleware receives
+//candidates returned by previous one. Then next word is chosen among remaining candidates in proportion to weights
+//if `base` is random, other policies choose among suffixes of remaining words. Generation meets dead end
+//if no candidates remain. Policies can be wrapped by several compositions, inner middlewares are applied first.
+func ComposeGeneratePolicy(base GeneratePolicy, mws ...Middleware) *ComposedGeneratePolicy {
+	return &ComposedGeneratePolicy{GeneratePolicy: base, middlewares: mws}
+}
+
+func (r *ComposedGeneratePolicy) unwrap() GeneratePolicy {
+	return r.GeneratePolicy
+}
+
+//FilterWords return middleware which remove candidates whose words are not kept by `keep`. End of phrase is always kept.
+func FilterWords(keep func(word string) bool) Middleware {
+	return func(prefix []string, cs []Candidate) []Candidate {
+		res := cs[:0]
+		for _, c := range cs {
+			if c.Word == NONWORD || keep(c.Word) {
+				res = append(res, c)
+			}
+		}
+		return res
+	}
+}
+
+//ReweightWords return middleware which multiply weights of candidates by weights of their words by `weight`
+func ReweightWords(weight func(word string) float64) Middleware {
+	return func(prefix []string, cs []Candidate) []Candidate {
+		for i := range cs {
+			cs[i].Weight *= weight(cs[i].Word)
+		}
+		return cs
+	}
+}
+
+//Fallback return middleware which apply `primary` and apply `fallback` to same candidates instead
+//if `primary` removes all of them
+func Fallback(primary Middleware, fallback Middleware) Middleware {
+	return func(prefix []string, cs []Candidate) []Candidate {
+		orig := append([]Candidate(nil), cs...)
+		if res := primary(prefix, cs); chosen(res) {
+			return res
+		}
+		return fallback(prefix, orig)
+	}
+}
+
+//chosen return true if any candidate of `cs` can be chosen
+func chosen(cs []Candidate) bool {
+	for _, c := range cs {
+		if c.Weight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//policyWrapper is implemented by policies which wrap other policy
+type policyWrapper interface {
+	unwrap() GeneratePolicy
+}
+
+//randomOf return random generator of policy `p` or of policy wrapped by it
+func randomOf(p GeneratePolicy) (*rand.Rand, bool) {
+	for p != nil {
+		if rp, ok := p.(randomPolicy); ok {
+			return rp.random(), true
+		}
+		w, ok := p.(policyWrapper)
+		if !ok {
+			break
+		}
+		p = w.unwrap()
+	}
+	return nil, false
+}
+
+//middlewaresOf return middlewares of policy `p` and of policies wrapped by it in order of application
+func middlewaresOf(p GeneratePolicy) []Middleware {
+	var mws []Middleware
+	for p != nil {
+		if cp, ok := p.(*ComposedGeneratePolicy); ok {
+			mws = append(append([]Middleware(nil), cp.middlewares...), mws...)
+		}
+		w, ok := p.(policyWrapper)
+		if !ok {
+			break
+		}
+		p = w.unwrap()
+	}
+	return mws
+}
+
+//chooseCandidate pass transitions `ts` of prefix `p` with suffixes `sx` through middlewares `mws` and choose suffix
+//of remaining candidates by weights using `rnd` or by policy of chain if `rnd` is nil.
+//Suffixes `sx` may be nil if `rnd` is set, then chosen suffix has no source.
+//Return probability of chosen word among transitions and false if no candidates remain.
+func (r *MarkovChain) chooseCandidate(p Prefix, ts []transition, sx []Suffix, mws []Middleware, rnd *rand.Rand) (Suffix, float64, bool) {
+	cs := make([]Candidate, len(ts))
+	for i, t := range ts {
+		cs[i] = Candidate{Word: t.word, Weight: t.prob}
+	}
+	prefix := append([]string(nil), p.words[:p.n]...)
+	for _, mw := range mws {
+		cs = mw(prefix, cs)
+	}
+	var total float64
+	for _, c := range cs {
+		if c.Weight > 0 {
+			total += c.Weight
+		}
+	}
+	if total == 0 {
+		return Suffix{src: NOSOURCE, word: NONWORD}, 0, false
+	}
+	// probability of word among transitions is kept for scoring, words added by middlewares have none
+	prob := func(word string) float64 {
+		for _, t := range ts {
+			if t.word == word {
+				return t.prob
+			}
+		}
+		return 0
+	}
+
+	if rnd == nil {
+		words := make(map[string]bool, len(cs))
+		for _, c := range cs {
+			if c.Weight > 0 {
+				words[c.Word] = true
+			}
+		}
+		var kept []Suffix
+		for _, s := range sx {
+			if words[s.word] {
+				kept = append(kept, s)
+			}
+		}
+		if len(kept) > 0 {
+			s := r.policy.findSuffix(kept)
+			return s, prob(s.word), true
+		}
+	}
+
+	word := ""
+	x := 0.0
+	if rnd != nil {
+		x = rnd.Float64() * total
+	}
+	for _, c := range cs {
+		if c.Weight <= 0 {
+			continue
+		}
+		word = c.Word
+		if x -= c.Weight; x < 0 {
+			break
+		}
+	}
+
+	// suffix keep source of word if word is transition of prefix
+	var occurrences []Suffix
+	for _, s := range sx {
+		if s.word == word {
+			occurrences = append(occurrences, s)
+		}
+	}
+	switch {
+	case len(occurrences) == 0:
+		return Suffix{src: NOSOURCE, word: word}, prob(word), true
+	case rnd != nil:
+		return occurrences[rnd.Intn(len(occurrences))], prob(word), true
+	}
+	return occurrences[0], prob(word), true
+}
@@ -0,0 +1,79 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware1(t *testing.T) {
+	ss := []string{"a b c", "a b d"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(ComposeGeneratePolicy(testGeneratePolicy{}, FilterWords(func(word string) bool {
+		return word != "c"
+	})))
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("a", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b d", s)
+
+	// fallback replace candidates removed by filter
+	c.SetGeneratePolicy(ComposeGeneratePolicy(testGeneratePolicy{}, Fallback(
+		FilterWords(func(word string) bool { return false }),
+		func(prefix []string, cs []Candidate) []Candidate {
+			return []Candidate{{Word: "z", Weight: 1}}
+		},
+	)))
+	s, err = c.GenerateAnswer("a", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "a z", s)
+}
+
+func TestMiddleware2(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c"}
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(prefix []string, cs []Candidate) []Candidate {
+			calls = append(calls, name)
+			return cs
+		}
+	}
+	base := NewRandomGeneratePolicy(1)
+	inner := ComposeGeneratePolicy(base, trace("first"), ReweightWords(func(word string) float64 {
+		if word == "c" {
+			return 0
+		}
+		return 1
+	}))
+	outer := ComposeGeneratePolicy(NewNoveltyGeneratePolicy(inner, 1), trace("second"))
+	rnd, ok := randomOf(outer)
+	assert.True(t, ok)
+	assert.Equal(t, base.rnd, rnd)
+	_, ok = noveltyOf(outer)
+	assert.True(t, ok)
+
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(outer)
+	assert.NoError(t, c.Build(ss))
+	c.policy.init(&c)
+	for i := 0; i < 20; i++ {
+		s, _, ok := c.findSuffix(Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2})
+		assert.True(t, ok)
+		assert.Equal(t, "d", s.word)
+	}
+	assert.Equal(t, []string{"first", "second"}, calls[:2])
+}
+
+func TestSeededPolicy1(t *testing.T) {
+	ss := benchTextBlocks(100, 20)
+	var texts []string
+	for i := 0; i < 2; i++ {
+		c := NewMarkovChain()
+		c.SetGeneratePolicy(NewRandomGeneratePolicy(42))
+		assert.NoError(t, c.Build(ss))
+		s, err := c.GenerateSentence(20)
+		assert.NoError(t, err)
+		texts = append(texts, s)
+	}
+	assert.Equal(t, texts[0], texts[1])
+}
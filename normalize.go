@@ -0,0 +1,245 @@
+package xrich
+
+import (
+	"strings"
+	"unicode"
+)
+
+//Normalizer convert word into key which is used to match words of message with words of chain.
+//Words of generated text keep its original form.
+type Normalizer interface {
+	Normalize(word string) string
+}
+
+//CaseNormalizer fold case of word
+type CaseNormalizer struct{}
+
+//Normalize return word in lower case
+func (r CaseNormalizer) Normalize(word string) string {
+	return strings.ToLower(word)
+}
+
+//StemNormalizer fold case of word and remove its inflection ending.
+//Russian words are stemmed by snowball algorithm, english words by first step of porter algorithm.
+type StemNormalizer struct{}
+
+//Normalize return stem of word in lower case
+func (r StemNormalizer) Normalize(word string) string {
+	w := strings.ToLower(word)
+	for _, c := range w {
+		if unicode.Is(unicode.Cyrillic, c) {
+			return stemRussian(w)
+		}
+	}
+	return stemEnglish(w)
+}
+
+//russian stemmer
+
+const ruVowels = "аеиоуыэюя"
+
+var (
+	ruPerfectiveGerund1 = []string{"в", "вши", "вшись"}
+	ruPerfectiveGerund2 = []string{"ив", "ивши", "ившись", "ыв", "ывши", "ывшись"}
+	ruAdjective         = []string{"ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом",
+		"его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}
+	ruParticiple1 = []string{"ем", "нн", "вш", "ющ", "щ"}
+	ruParticiple2 = []string{"ивш", "ывш", "ующ"}
+	ruReflexive   = []string{"ся", "сь"}
+	ruVerb1       = []string{"ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны", "ть", "ешь", "нно"}
+	ruVerb2       = []string{"ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл", "им", "ым", "ен",
+		"ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь", "ую", "ю"}
+	ruNoun = []string{"а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией", "ей", "ой", "ий", "й",
+		"иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь", "ию", "ью", "ю", "ия", "ья", "я"}
+	ruSuperlative  = []string{"ейш", "ейше"}
+	ruDerivational = []string{"ост", "ость"}
+	ruPreceding    = "ая"
+)
+
+func isRuVowel(c rune) bool {
+	return strings.ContainsRune(ruVowels, c)
+}
+
+//ruRegions return start of RV region (after first vowel) and R2 region of word
+func ruRegions(w []rune) (rv int, r2 int) {
+	rv, r1, r2 := len(w), len(w), len(w)
+	for i, c := range w {
+		if isRuVowel(c) {
+			rv = i + 1
+			break
+		}
+	}
+	for i := 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r1 = i + 1
+			break
+		}
+	}
+	for i := r1 + 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r2 = i + 1
+			break
+		}
+	}
+	return rv, r2
+}
+
+//longestEnding return longest ending of `w` from `endings` which starts not before `limit` or empty string
+func longestEnding(w []rune, limit int, endings []string) string {
+	res := ""
+	for _, e := range endings {
+		n := len([]rune(e))
+		if n > len([]rune(res)) && len(w)-n >= limit && string(w[len(w)-n:]) == e {
+			res = e
+		}
+	}
+	return res
+}
+
+//removeEnding remove longest ending from groups `preceded` and `plain` which starts not before `limit`.
+//Ending from `preceded` group is removed only if it follows `а` or `я`.
+func removeEnding(w []rune, limit int, preceded []string, plain []string) ([]rune, bool) {
+	e1 := longestEnding(w, limit, preceded)
+	e2 := longestEnding(w, limit, plain)
+	if e1 == "" && e2 == "" {
+		return w, false
+	}
+	if len([]rune(e2)) >= len([]rune(e1)) {
+		return w[:len(w)-len([]rune(e2))], true
+	}
+	start := len(w) - len([]rune(e1))
+	if start-1 < limit || !strings.ContainsRune(ruPreceding, w[start-1]) {
+		return w, false
+	}
+	return w[:start], true
+}
+
+func stemRussian(word string) string {
+	w := []rune(strings.Replace(word, "ё", "е", -1))
+	rv, r2 := ruRegions(w)
+
+	// step 1
+	var ok bool
+	if w, ok = removeEnding(w, rv, ruPerfectiveGerund1, ruPerfectiveGerund2); !ok {
+		w, _ = removeEnding(w, rv, nil, ruReflexive)
+		if w, ok = removeEnding(w, rv, nil, ruAdjective); ok {
+			w, _ = removeEnding(w, rv, ruParticiple1, ruParticiple2)
+		} else if w, ok = removeEnding(w, rv, ruVerb1, ruVerb2); !ok {
+			w, _ = removeEnding(w, rv, nil, ruNoun)
+		}
+	}
+
+	// step 2
+	w, _ = removeEnding(w, rv, nil, []string{"и"})
+
+	// step 3
+	w, _ = removeEnding(w, r2, nil, ruDerivational)
+
+	// step 4
+	w, superlative := removeEnding(w, rv, nil, ruSuperlative)
+	if longestEnding(w, rv, []string{"нн"}) != "" {
+		return string(w[:len(w)-1])
+	}
+	if !superlative {
+		w, _ = removeEnding(w, rv, nil, []string{"ь"})
+	}
+	return string(w)
+}
+
+//english stemmer
+
+func isEnConsonant(w []rune, i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !isEnConsonant(w, i-1)
+	}
+	return true
+}
+
+//enMeasure return number of vowel-consonant sequences of word
+func enMeasure(w []rune) int {
+	m := 0
+	vowel := false
+	for i := range w {
+		if !isEnConsonant(w, i) {
+			vowel = true
+		} else if vowel {
+			m++
+			vowel = false
+		}
+	}
+	return m
+}
+
+func enHasVowel(w []rune) bool {
+	for i := range w {
+		if !isEnConsonant(w, i) {
+			return true
+		}
+	}
+	return false
+}
+
+//enEndsCVC return true if word ends with consonant-vowel-consonant and last consonant is not w, x or y
+func enEndsCVC(w []rune) bool {
+	n := len(w)
+	if n < 3 || !isEnConsonant(w, n-3) || isEnConsonant(w, n-2) || !isEnConsonant(w, n-1) {
+		return false
+	}
+	return !strings.ContainsRune("wxy", w[n-1])
+}
+
+//stemEnglish remove plural and verb endings by first step of porter algorithm
+func stemEnglish(word string) string {
+	w := []rune(word)
+	if len(w) <= 2 {
+		return word
+	}
+	s := string(w)
+
+	// step 1a
+	switch {
+	case strings.HasSuffix(s, "sses"), strings.HasSuffix(s, "ies"):
+		w = w[:len(w)-2]
+	case strings.HasSuffix(s, "ss"):
+		// keep
+	case strings.HasSuffix(s, "s"):
+		w = w[:len(w)-1]
+	}
+	s = string(w)
+
+	// step 1b
+	removed := false
+	switch {
+	case strings.HasSuffix(s, "eed"):
+		if enMeasure(w[:len(w)-3]) > 0 {
+			w = w[:len(w)-1]
+		}
+	case strings.HasSuffix(s, "ed") && enHasVowel(w[:len(w)-2]):
+		w = w[:len(w)-2]
+		removed = true
+	case strings.HasSuffix(s, "ing") && enHasVowel(w[:len(w)-3]):
+		w = w[:len(w)-3]
+		removed = true
+	}
+	if removed {
+		s = string(w)
+		n := len(w)
+		switch {
+		case strings.HasSuffix(s, "at"), strings.HasSuffix(s, "bl"), strings.HasSuffix(s, "iz"):
+			w = append(w, 'e')
+		case n >= 2 && w[n-1] == w[n-2] && isEnConsonant(w, n-1) && !strings.ContainsRune("lsz", w[n-1]):
+			w = w[:n-1]
+		case enMeasure(w) == 1 && enEndsCVC(w):
+			w = append(w, 'e')
+		}
+	}
+
+	// step 1c
+	if n := len(w); n > 1 && w[n-1] == 'y' && enHasVowel(w[:n-1]) {
+		w[n-1] = 'i'
+	}
+	return string(w)
+}
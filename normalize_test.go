@@ -0,0 +1,42 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStemRussian(t *testing.T) {
+	n := StemNormalizer{}
+	for word, stem := range map[string]string{
+		"Кота":       "кот",
+		"кот":        "кот",
+		"красивая":   "красив",
+		"книгами":    "книг",
+		"делаешь":    "дела",
+		"выучившись": "выуч",
+		"привет":     "привет",
+		"длиннейший": "длин",
+		"ёлка":       "елк",
+	} {
+		assert.Equal(t, stem, n.Normalize(word), word)
+	}
+}
+
+func TestStemEnglish(t *testing.T) {
+	n := StemNormalizer{}
+	for word, stem := range map[string]string{
+		"Cats":     "cat",
+		"caresses": "caress",
+		"ponies":   "poni",
+		"agreed":   "agree",
+		"feed":     "feed",
+		"running":  "run",
+		"hopped":   "hop",
+		"filing":   "file",
+		"happy":    "happi",
+		"sing":     "sing",
+	} {
+		assert.Equal(t, stem, n.Normalize(word), word)
+	}
+}
@@ -0,0 +1,200 @@
+package xrich
+
+//NoveltyGeneratePolicy choose elements by wrapped policy and avoid texts which were generated recently
+//in same conversation. Sentence is generated again up to Attempts times while it repeats one of Window recent texts
+//and answer is chosen among phrases which are not recent. If all texts are repeats, least recent one is taken
+//or no text is returned if Reject is set. Streamed sentences are remembered but not generated again.
+//Texts of at most Conversations conversations are remembered, texts of least recently used ones are forgotten.
+type NoveltyGeneratePolicy struct {
+	GeneratePolicy
+	Window        int  // number of remembered texts of conversation
+	Attempts      int  // max number of generations of sentence
+	Reject        bool // return no text instead of least recent repeat
+	Conversations int  // max number of remembered conversations, unlimited if zero
+	conversation  string
+	history       map[string][]string // recent texts of conversations, most recent last
+	used          map[string]int      // time of last use of conversations counted in remembered texts
+	clock         int
+}
+
+//NewNoveltyGeneratePolicy return policy which wrap policy `base` and avoid `window` recent texts of conversation.
+//Texts of 1000 conversations are remembered.
+func NewNoveltyGeneratePolicy(base GeneratePolicy, window int) *NoveltyGeneratePolicy {
+	return &NoveltyGeneratePolicy{
+		GeneratePolicy: base,
+		Window:         window,
+		Attempts:       5,
+		Conversations:  1000,
+		history:        make(map[string][]string),
+		used:           make(map[string]int),
+	}
+}
+
+//SetConversation set key of conversation whose recent texts are avoided, e.g. id of chat
+func (r *NoveltyGeneratePolicy) SetConversation(key string) {
+	r.conversation = key
+	if _, ok := r.history[key]; ok {
+		r.touch()
+	}
+}
+
+//ForgetConversation forget recent texts of conversation `key`, e.g. when bot leaves chat
+func (r *NoveltyGeneratePolicy) ForgetConversation(key string) {
+	delete(r.history, key)
+	delete(r.used, key)
+}
+
+//age return number of texts generated in conversation after text `text` or -1 if it is not recent
+func (r *NoveltyGeneratePolicy) age(text string) int {
+	h := r.history[r.conversation]
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i] == text {
+			return len(h) - 1 - i
+		}
+	}
+	return -1
+}
+
+//remember add text `text` to recent texts of conversation
+func (r *NoveltyGeneratePolicy) remember(text string) {
+	h := append(r.history[r.conversation], text)
+	if len(h) > r.Window {
+		h = h[len(h)-r.Window:]
+	}
+	r.history[r.conversation] = h
+	r.touch()
+	if r.Conversations > 0 && len(r.history) > r.Conversations {
+		r.forgetLeastUsed()
+	}
+}
+
+//touch mark current conversation as most recently used
+func (r *NoveltyGeneratePolicy) touch() {
+	r.clock++
+	r.used[r.conversation] = r.clock
+}
+
+//forgetLeastUsed forget recent texts of least recently used conversation
+func (r *NoveltyGeneratePolicy) forgetLeastUsed() {
+	oldest, min := "", r.clock+1
+	for key, t := range r.used {
+		if t < min {
+			oldest, min = key, t
+		}
+	}
+	r.ForgetConversation(oldest)
+}
+
+func (r *NoveltyGeneratePolicy) unwrap() GeneratePolicy {
+	return r.GeneratePolicy
+}
+
+func (r *NoveltyGeneratePolicy) attempts() int {
+	if r.Attempts < 1 {
+		return 1
+	}
+	return r.Attempts
+}
+
+func (r *NoveltyGeneratePolicy) rejects() bool {
+	return r.Reject
+}
+
+//noveltyPolicy is implemented by policies which avoid texts generated recently
+type noveltyPolicy interface {
+	age(text string) int
+	remember(text string)
+	attempts() int
+	rejects() bool
+}
+
+//noveltyOf return novelty policy `p` or novelty policy wrapped by it
+func noveltyOf(p GeneratePolicy) (noveltyPolicy, bool) {
+	for p != nil {
+		if np, ok := p.(noveltyPolicy); ok {
+			return np, true
+		}
+		w, ok := p.(policyWrapper)
+		if !ok {
+			break
+		}
+		p = w.unwrap()
+	}
+	return nil, false
+}
+
+//novelTexts return indices of texts `texts` which are not recent for novelty policy `np`.
+//If all texts are recent, indices of least recent ones are returned unless policy rejects repeats.
+func novelTexts(np noveltyPolicy, texts []string) []int {
+	var novel, oldest []int
+	maxAge := -1
+	for i, t := range texts {
+		age := np.age(t)
+		switch {
+		case age < 0:
+			novel = append(novel, i)
+		case age > maxAge:
+			maxAge = age
+			oldest = append(oldest[:0], i)
+		case age == maxAge:
+			oldest = append(oldest, i)
+		}
+	}
+	if len(novel) > 0 {
+		return novel
+	}
+	if np.rejects() {
+		return nil
+	}
+	return oldest
+}
+
+//generateChecked return text generated by `generate` which is not blocked by content filter of chain
+//and not recent for novelty policy of chain. Text is generated again up to number of attempts of policy
+//while it is blocked or recent.
+func (r *MarkovChain) generateChecked(generate func() generated) generated {
+	np, novelty := noveltyOf(r.policy)
+	if !novelty && r.filter == nil {
+		return generate()
+	}
+	attempts := filterAttempts
+	if novelty {
+		attempts = np.attempts()
+	}
+	var gs []generated
+	var texts []string
+	for i := 0; i < attempts; i++ {
+		g := generate()
+		if len(g.words) == 0 {
+			return g
+		}
+		text := r.join(suffixWords(g.words))
+		if r.blocked(text) {
+			continue
+		}
+		gs = append(gs, g)
+		texts = append(texts, text)
+		if !novelty || np.age(text) < 0 {
+			break
+		}
+	}
+	switch {
+	case len(gs) == 0:
+		return generated{stop: StopBlocked}
+	case !novelty:
+		return gs[0]
+	}
+	keep := novelTexts(np, texts)
+	if len(keep) == 0 {
+		return generated{stop: StopRepeat}
+	}
+	np.remember(texts[keep[0]])
+	return gs[keep[0]]
+}
+
+//rememberText add text of words `words` to recent texts of novelty policy of chain if it is set
+func (r *MarkovChain) rememberText(words []Suffix) {
+	if np, ok := noveltyOf(r.policy); ok && len(words) > 0 {
+		np.remember(r.join(suffixWords(words)))
+	}
+}
@@ -0,0 +1,76 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNovelty1(t *testing.T) {
+	c := NewMarkovChain()
+	np := NewNoveltyGeneratePolicy(testGeneratePolicy{}, 2)
+	np.Reject = true
+	c.SetGeneratePolicy(np)
+	assert.NoError(t, c.Build([]string{"a b c"}))
+	s, err := c.GenerateSentence(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c", s)
+	_, err = c.GenerateSentence(3)
+	assert.Equal(t, ErrRepeated, err)
+	res := c.GenerateSentenceResult(GenerateOptions{StopAtEnd: true})
+	assert.Equal(t, ErrRepeated, res.Err)
+	assert.Equal(t, StopRepeat, res.Stop)
+
+	// other conversation has own recent texts
+	np.SetConversation("other")
+	s, err = c.GenerateSentence(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c", s)
+
+	// least recent repeat is taken if repeats are not rejected
+	np.Reject = false
+	s, err = c.GenerateSentence(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c", s)
+}
+
+func TestNovelty2(t *testing.T) {
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(NewNoveltyGeneratePolicy(testGeneratePolicy{}, 1))
+	assert.NoError(t, c.Build([]string{"a b c", "x y z"}))
+	s, err := c.GenerateAnswer("a x", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c", s)
+	s, err = c.GenerateAnswer("a x", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "x y z", s)
+	s, err = c.GenerateAnswer("a x", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c", s)
+}
+
+func TestNoveltyConversations1(t *testing.T) {
+	c := NewMarkovChain()
+	np := NewNoveltyGeneratePolicy(testGeneratePolicy{}, 2)
+	np.Reject = true
+	np.Conversations = 2
+	c.SetGeneratePolicy(np)
+	assert.NoError(t, c.Build([]string{"a b c"}))
+	for _, key := range []string{"x", "y", "x", "z"} {
+		np.SetConversation(key)
+		c.GenerateSentence(3)
+	}
+	// least recently used conversation is forgotten
+	assert.Len(t, np.history, 2)
+	np.SetConversation("x")
+	_, err := c.GenerateSentence(3)
+	assert.Equal(t, ErrRepeated, err)
+	np.SetConversation("y")
+	_, err = c.GenerateSentence(3)
+	assert.NoError(t, err)
+
+	np.SetConversation("x")
+	np.ForgetConversation("x")
+	_, err = c.GenerateSentence(3)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,171 @@
+package xrich
+
+import (
+	"regexp"
+)
+
+//PlaceholderMode choose whether URLs, mentions, numbers, hashtags and emoji of text blocks are replaced by placeholders
+//and how placeholders of generated text are resolved
+type PlaceholderMode int
+
+const (
+	//PlaceholdersOff keep URLs, mentions, numbers, hashtags and emoji in text blocks, they are cleared like other symbols
+	PlaceholdersOff PlaceholderMode = iota
+	//PlaceholdersDrop remove placeholders from generated text
+	PlaceholdersDrop
+	//PlaceholdersFill replace placeholders of generated text by values sampled from text blocks,
+	//placeholders without known values are removed
+	PlaceholdersFill
+)
+
+const (
+	// PlaceholderURL replace URLs
+	PlaceholderURL = "PHURL"
+	// PlaceholderMention replace @mentions
+	PlaceholderMention = "PHMENTION"
+	// PlaceholderHashtag replace #hashtags
+	PlaceholderHashtag = "PHHASHTAG"
+	// PlaceholderNumber replace numbers
+	PlaceholderNumber = "PHNUMBER"
+	// PlaceholderEmoji replace emoji
+	PlaceholderEmoji = "PHEMOJI"
+)
+
+//placeholderPatterns detect values of placeholders, earlier patterns are replaced first
+var placeholderPatterns = []struct {
+	token string
+	re    *regexp.Regexp
+}{
+	{PlaceholderURL, regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S*[^\s.,!?;:)\]}»"'…]`)},
+	{PlaceholderMention, regexp.MustCompile(`\B@[\p{L}\p{N}_]+`)},
+	{PlaceholderHashtag, regexp.MustCompile(`\B#[\p{L}\p{N}_]+`)},
+	{PlaceholderNumber, regexp.MustCompile(`\b\d+(?:[.,:]\d+)*\b`)},
+	{PlaceholderEmoji, regexp.MustCompile(`[\x{1F000}-\x{1FAFF}\x{2600}-\x{27BF}\x{2B00}-\x{2BFF}\x{FE0F}\x{200D}\x{20E3}]+`)},
+}
+
+//maxPlaceholderValues is max number of remembered values of every placeholder, most recent values are kept
+const maxPlaceholderValues = 1000
+
+//placeholders replace values in text blocks by placeholders and remember values to fill generated text
+type placeholders struct {
+	mode   PlaceholderMode
+	values map[string][]string
+	seen   map[string]int // number of values of placeholder seen in text blocks
+}
+
+//placeholderValue is value of placeholder `token` found in text block
+type placeholderValue struct {
+	token string
+	value string
+}
+
+//SetPlaceholders enable replacement of URLs, @mentions, numbers, #hashtags and emoji of text blocks by placeholders
+//and choose how placeholders are resolved in generated text. It must be called before `Build`.
+//Values for filling are remembered only in memory, so chain loaded from store fills placeholders
+//by values of text blocks built after loading. Compiled chain keeps values with its transitions.
+//Character chains do not use placeholders.
+func (r *MarkovChain) SetPlaceholders(mode PlaceholderMode) {
+	if mode == PlaceholdersOff || r.chars {
+		r.placeholders = nil
+		return
+	}
+	if r.placeholders == nil {
+		r.placeholders = &placeholders{values: make(map[string][]string), seen: make(map[string]int)}
+	}
+	r.placeholders.mode = mode
+}
+
+//IsPlaceholder return true if token `s` is placeholder
+func IsPlaceholder(s string) bool {
+	for _, p := range placeholderPatterns {
+		if p.token == s {
+			return true
+		}
+	}
+	return false
+}
+
+//replace return text `text` with values replaced by placeholders and replaced values in order of replacement
+func (r *placeholders) replace(text string) (string, []placeholderValue) {
+	var vs []placeholderValue
+	for _, p := range placeholderPatterns {
+		token := p.token
+		text = p.re.ReplaceAllStringFunc(text, func(v string) string {
+			vs = append(vs, placeholderValue{token, v})
+			return " " + token + " "
+		})
+	}
+	return text, vs
+}
+
+//remember add values `vs` of text block. Values are remembered in order of text blocks
+//even if blocks are tokenized concurrently, so chain fills placeholders in same way after any build.
+func (r *placeholders) remember(vs []placeholderValue) {
+	if r == nil {
+		return
+	}
+	for _, v := range vs {
+		r.add(v.token, v.value)
+	}
+}
+
+//add remember value `v` of placeholder `token`
+func (r *placeholders) add(token string, v string) {
+	n := r.seen[token]
+	r.seen[token] = n + 1
+	if n < maxPlaceholderValues {
+		r.values[token] = append(r.values[token], v)
+		return
+	}
+	r.values[token][n%maxPlaceholderValues] = v
+}
+
+//merge remember values of placeholders `other`
+func (r *placeholders) merge(other *placeholders) {
+	if r == nil || other == nil {
+		return
+	}
+	for token, vs := range other.values {
+		for _, v := range vs {
+			r.add(token, v)
+		}
+	}
+}
+
+//clone return copy of placeholders which does not change with them or nil if placeholders are nil
+func (r *placeholders) clone() *placeholders {
+	if r == nil {
+		return nil
+	}
+	c := &placeholders{mode: r.mode, values: make(map[string][]string), seen: make(map[string]int)}
+	for token, vs := range r.values {
+		c.values[token] = append([]string(nil), vs...)
+	}
+	for token, n := range r.seen {
+		c.seen[token] = n
+	}
+	return c
+}
+
+//resolvePlaceholder return word of suffix `s` with placeholder filled by value of text blocks.
+//Return false if placeholder is dropped.
+func (r *MarkovChain) resolvePlaceholder(s Suffix) (Suffix, bool) {
+	if r.placeholders == nil || !IsPlaceholder(s.word) {
+		return s, true
+	}
+	if r.placeholders.mode != PlaceholdersFill {
+		return s, false
+	}
+	ph := r.placeholders
+	vs := ph.values[s.word]
+	if len(vs) == 0 {
+		return s, false
+	}
+	// non-random policies take most recent value
+	i := (ph.seen[s.word] - 1) % maxPlaceholderValues
+	if rnd, ok := randomOf(r.policy); ok {
+		i = rnd.Intn(len(vs))
+	}
+	s.word = vs[i]
+	return s, true
+}
@@ -0,0 +1,60 @@
+package xrich
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlaceholders1(t *testing.T) {
+	c := NewMarkovChain()
+	c.SetPlaceholders(PlaceholdersFill)
+	words, err := c.tokenize("see https://example.com/a?b=1, @bob #news 42 times 😀")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"see", PlaceholderURL, ",", PlaceholderMention, PlaceholderHashtag, PlaceholderNumber,
+		"times", PlaceholderEmoji}, words)
+	// e-mail is not mention
+	words, err = c.tokenize("mail a@b.com in 2019")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mail", "a", "@b", ".com", "in", PlaceholderNumber}, words)
+	assert.True(t, IsPlaceholder(PlaceholderURL))
+	assert.False(t, IsPlaceholder("url"))
+}
+
+func TestPlaceholders2(t *testing.T) {
+	ss := []string{"see www.example.com now", "see http://other.org now"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	c.SetPlaceholders(PlaceholdersFill)
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateSentence(3)
+	assert.NoError(t, err)
+	assert.Equal(t, "see http://other.org now", s)
+	res := c.GenerateSentenceResult(GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, []string{"see", "http://other.org", "now"}, res.Tokens)
+
+	c.SetPlaceholders(PlaceholdersDrop)
+	s, err = c.GenerateAnswer("see", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "see now", s)
+}
+
+func TestPlaceholders3(t *testing.T) {
+	ss := make([]string, 200)
+	for i := range ss {
+		ss[i] = fmt.Sprintf("see %d now", i)
+	}
+	c1 := NewMarkovChain()
+	c1.SetPlaceholders(PlaceholdersFill)
+	assert.NoError(t, c1.Build(ss))
+	c2 := NewMarkovChain()
+	c2.SetGeneratePolicy(testGeneratePolicy{})
+	c2.SetPlaceholders(PlaceholdersFill)
+	assert.NoError(t, c2.BuildParallel(ss, 4))
+	assert.Equal(t, c1.placeholders.values, c2.placeholders.values)
+	s, ok := c2.resolvePlaceholder(Suffix{word: PlaceholderNumber})
+	assert.True(t, ok)
+	assert.Equal(t, "199", s.word)
+}
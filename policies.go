@@ -8,24 +8,43 @@ type GeneratePolicy interface {
 	init(c *MarkovChain)
 	findFirstPrefix(c *MarkovChain) Prefix
 	findNextPrefix(c *MarkovChain) Prefix
+	findTriggerPrefix(n int) int
 	findSuffix(sx []Suffix) Suffix
 	findPhrase(ss []string) string
 }
 
 //RandomGeneratePolicy choose random element
 type RandomGeneratePolicy struct {
-	rnd *rand.Rand
+	rnd    *rand.Rand
+	seeded bool
+}
+
+//NewRandomGeneratePolicy return policy which choose random elements using generator seeded by `seed`,
+//so chain generates same texts for same seed. Policy created by `new(RandomGeneratePolicy)` is seeded by time
+//on every generation.
+func NewRandomGeneratePolicy(seed int64) *RandomGeneratePolicy {
+	return &RandomGeneratePolicy{rnd: rand.New(rand.NewSource(seed)), seeded: true}
 }
 
 func (r *RandomGeneratePolicy) init(c *MarkovChain) {
+	if r.seeded {
+		return
+	}
 	r.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
 }
 
+func (r RandomGeneratePolicy) random() *rand.Rand {
+	return r.rnd
+}
+
 func (r RandomGeneratePolicy) findFirstPrefix(c *MarkovChain) Prefix {
-	return *c.keys[r.rnd.Intn(len(c.keys))]
+	return c.prefixAt(r.rnd.Intn(c.prefixCount()))
 }
 func (r RandomGeneratePolicy) findNextPrefix(c *MarkovChain) Prefix {
-	return *c.keys[r.rnd.Intn(len(c.keys))]
+	return c.prefixAt(r.rnd.Intn(c.prefixCount()))
+}
+func (r RandomGeneratePolicy) findTriggerPrefix(n int) int {
+	return r.rnd.Intn(n)
 }
 func (r RandomGeneratePolicy) findSuffix(sx []Suffix) Suffix {
 	return sx[r.rnd.Intn(len(sx))]
@@ -0,0 +1,66 @@
+package xrich
+
+import "sort"
+
+//Prediction is candidate for next word with its probability
+type Prediction struct {
+	Word string
+	Prob float64
+}
+
+//Predict return up to `k` most probable next words after words `prefixWords`.
+//Words are tokenized in same way as in `Build`. If chain does not know prefix of last words,
+//prediction is backed off to transitions of last word only and to start of phrase for empty input.
+//End of phrase is never predicted. Return ErrEmptyChain if chain has no transitions.
+func (r *MarkovChain) Predict(prefixWords []string, k int) (res []Prediction, err error) {
+	if r.isEmpty() {
+		return res, ErrEmptyChain
+	}
+	if k <= 0 {
+		return res, nil
+	}
+
+	var words []string
+	for _, w := range prefixWords {
+		ts, err := r.tokenize(w)
+		if err != nil {
+			return res, err
+		}
+		words = append(words, ts...)
+	}
+
+	prefix := r.startPrefix()
+	for _, w := range words {
+		prefix.lshift()
+		prefix.put(w)
+	}
+
+	if len(words) > 0 {
+		for _, t := range r.transitions(prefix) {
+			if t.word != NONWORD {
+				res = append(res, Prediction{t.word, t.prob})
+			}
+		}
+	}
+	if len(res) == 0 {
+		// backoff
+		lo := r.lowerOrder()
+		last := prefix.last()
+		for w, n := range lo.bigrams[last] {
+			if w != NONWORD {
+				res = append(res, Prediction{w, n / lo.bitotals[last]})
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Prob != res[j].Prob {
+			return res[i].Prob > res[j].Prob
+		}
+		return res[i].Word < res[j].Word
+	})
+	if len(res) > k {
+		res = res[:k]
+	}
+	return res, r.takeErr()
+}
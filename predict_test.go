@@ -0,0 +1,40 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPredict1(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c", "x b e"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	ps, err := c.Predict([]string{"a", "b"}, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, ps, 2) {
+		assert.Equal(t, Prediction{"c", 2.0 / 3}, ps[0])
+		assert.Equal(t, Prediction{"d", 1.0 / 3}, ps[1])
+	}
+}
+
+func TestPredict2(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c", "x b e"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	ps, err := c.Predict([]string{"b"}, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []Prediction{{"c", 0.5}, {"d", 0.25}, {"e", 0.25}}, ps)
+}
+
+func TestPredict3(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c", "x b e"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	ps, err := c.Predict(nil, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Prediction{{"a", 0.75}}, ps)
+	ps, err = c.Predict([]string{"a b c"}, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, ps)
+}
@@ -116,3 +116,41 @@ func BenchmarkHashmapSearchHashfn5(b *testing.B) {
 	p := PrefixH{[2]string{"строка1", "строка2"}}
 	getKeyString(b, p.hashfn5)
 }
+
+//prefixKeyWords return words of order 2 prefixes of benchmark text blocks to compare memory of map keyed by
+//two words and map keyed by Prefix
+func prefixKeyWords() [][2]string {
+	var ws [][2]string
+	for _, s := range benchTextBlocks(2000, 1000) {
+		words := strings.Fields(s)
+		for i := 1; i < len(words); i++ {
+			ws = append(ws, [2]string{words[i-1], words[i]})
+		}
+	}
+	return ws
+}
+
+func BenchmarkPrefixKeyArray2(b *testing.B) {
+	ws := prefixKeyWords()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m := make(map[Prefix0][]Suffix)
+		for _, w := range ws {
+			p := Prefix0{w}
+			m[p] = append(m[p], Suffix{word: w[1]})
+		}
+	}
+}
+
+func BenchmarkPrefixKeyPrefix(b *testing.B) {
+	ws := prefixKeyWords()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m := make(map[Prefix][]Suffix)
+		for _, w := range ws {
+			p := Prefix{n: 2}
+			p.words[0], p.words[1] = w[0], w[1]
+			m[p] = append(m[p], Suffix{word: w[1]})
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package xrich
+
+import (
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+//Stats is size of chain
+type Stats struct {
+	Prefixes    int // number of prefixes
+	Transitions int // number of distinct transitions from prefix to word
+	Suffixes    int // number of suffixes, i.e. occurrences of transitions
+	Vocabulary  int // number of distinct words of suffixes
+	Bytes       int // approximate size of chain in memory if states transitions table is kept in memory, including memory budget
+}
+
+//String return sizes as key=value pairs
+func (r Stats) String() string {
+	return fmt.Sprintf("prefixes=%d transitions=%d suffixes=%d vocabulary=%d bytes=%d",
+		r.Prefixes, r.Transitions, r.Suffixes, r.Vocabulary, r.Bytes)
+}
+
+//prefixOverhead is approximate size of prefix in keys of chain and in map of states transitions table
+var prefixOverhead = 2*int(unsafe.Sizeof(Prefix{})) + int(unsafe.Sizeof(mapEntry{})) + int(unsafe.Sizeof(&Prefix{}))
+
+//approxBytes return approximate size of prefix `p` with suffixes `sx` in memory
+func approxBytes(p Prefix, sx []Suffix) int {
+	return prefixBytes(p) + suffixBytes(sx)
+}
+
+//prefixBytes return approximate size of prefix `p` without suffixes in memory
+func prefixBytes(p Prefix) int {
+	return prefixOverhead + p.n*int(unsafe.Sizeof(&p))
+}
+
+//suffixBytes return approximate size of suffixes `sx` in memory
+func suffixBytes(sx []Suffix) int {
+	n := len(sx) * int(unsafe.Sizeof(Suffix{}))
+	for _, s := range sx {
+		n += len(s.word)
+	}
+	return n
+}
+
+//Stats return size of chain
+func (r *MarkovChain) Stats() (Stats, error) {
+	var st Stats
+	words := make(map[string]bool)
+	for _, p := range r.keys {
+		sx, err := r.store.Get(*p)
+		if err != nil {
+			return st, &StoreError{Op: "get", Err: err}
+		}
+		st.Prefixes++
+		st.Suffixes += len(sx)
+		st.Transitions += len(countTransitions(sx))
+		st.Bytes += approxBytes(*p, sx)
+		for _, s := range sx {
+			words[s.word] = true
+		}
+	}
+	st.Vocabulary = len(words)
+	if r.budget != nil {
+		st.Bytes += st.Prefixes * usageOverhead
+	}
+	return st, nil
+}
+
+//PruneOptions set which transitions are removed by `Prune`, zero option is disabled
+type PruneOptions struct {
+	MinCount      int     // remove transitions which occur less than MinCount times
+	MaxSuffixes   int     // keep only MaxSuffixes most frequent distinct transitions of every prefix
+	DropSingle    bool    // remove prefixes with single distinct transition except start of phrase
+	MaxVocabulary int     // keep only MaxVocabulary most frequent words, transitions to other words and prefixes with them are removed
+	MinWeight     float64 // remove suffixes whose weight by age is less than MinWeight, see `SetHalfLife`
+}
+
+//Prune remove rare transitions from chain by options `opts` to reduce its size.
+//Prefixes which lose all transitions are removed, so generation may stop earlier at dead end.
+func (r *MarkovChain) Prune(opts PruneOptions) error {
+	var vocab map[string]bool
+	if opts.MaxVocabulary > 0 {
+		var err error
+		if vocab, err = r.topWords(opts.MaxVocabulary); err != nil {
+			return err
+		}
+	}
+
+	var weight func(s Suffix) float64
+	if opts.MinWeight > 0 {
+		weight = r.weightFunc()
+	}
+
+	keys := make([]*Prefix, 0, len(r.keys))
+	defer func() {
+		r.lower = nil
+		r.SetNormalizer(r.norm)
+	}()
+	for i, p := range r.keys {
+		sx, err := r.store.Get(*p)
+		if err != nil {
+			r.keys = append(keys, r.keys[i:]...)
+			return &StoreError{Op: "get", Err: err}
+		}
+		kept := pruneSuffixes(*p, sx, opts, vocab, weight)
+		if len(kept) != len(sx) {
+			if err := r.store.Set(*p, kept); err != nil {
+				r.keys = append(keys, r.keys[i:]...)
+				return &StoreError{Op: "set", Err: err}
+			}
+			r.budget.resize(*p, kept)
+		}
+		if len(kept) > 0 {
+			keys = append(keys, p)
+		}
+	}
+	r.logger.Debugw("chain is pruned", "func", "Prune", "prefixes", len(keys), "removed", len(r.keys)-len(keys))
+	r.keys = keys
+	return nil
+}
+
+//topWords return `n` most frequent words of suffixes and NONWORD
+func (r *MarkovChain) topWords(n int) (map[string]bool, error) {
+	counts := make(map[string]int)
+	for _, p := range r.keys {
+		sx, err := r.store.Get(*p)
+		if err != nil {
+			return nil, &StoreError{Op: "get", Err: err}
+		}
+		for _, s := range sx {
+			counts[s.word]++
+		}
+	}
+	words := make([]string, 0, len(counts))
+	for w := range counts {
+		words = append(words, w)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > n {
+		words = words[:n]
+	}
+	vocab := make(map[string]bool, len(words)+1)
+	for _, w := range words {
+		vocab[w] = true
+	}
+	vocab[NONWORD] = true
+	return vocab, nil
+}
+
+//pruneSuffixes return suffixes `sx` of prefix `p` which are kept by options `opts`, vocabulary `vocab`
+//and weights by `weight` if they are not nil. Order of kept suffixes is not changed.
+func pruneSuffixes(p Prefix, sx []Suffix, opts PruneOptions, vocab map[string]bool, weight func(s Suffix) float64) []Suffix {
+	if vocab != nil {
+		for _, w := range p.words[:p.n] {
+			if !vocab[w] {
+				return nil
+			}
+		}
+	}
+	if weight != nil {
+		var recent []Suffix
+		for _, s := range sx {
+			if weight(s) >= opts.MinWeight {
+				recent = append(recent, s)
+			}
+		}
+		sx = recent
+	}
+	ts := countTransitions(sx)
+	var kept []transition
+	for _, t := range ts {
+		if t.count >= opts.MinCount && (vocab == nil || vocab[t.word]) {
+			kept = append(kept, t)
+		}
+	}
+	if opts.MaxSuffixes > 0 && len(kept) > opts.MaxSuffixes {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return kept[i].count > kept[j].count
+		})
+		kept = kept[:opts.MaxSuffixes]
+	}
+	if opts.DropSingle && len(kept) == 1 && !p.isStart() {
+		return nil
+	}
+	if len(kept) == len(ts) {
+		return sx
+	}
+
+	words := make(map[string]bool, len(kept))
+	for _, t := range kept {
+		words[t.word] = true
+	}
+	var res []Suffix
+	for _, s := range sx {
+		if words[s.word] {
+			res = append(res, s)
+		}
+	}
+	return res
+}
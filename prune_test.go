@@ -0,0 +1,66 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats1(t *testing.T) {
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build([]string{"a b a b"}))
+	st, err := c.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, st.Prefixes)
+	assert.Equal(t, 5, st.Suffixes)
+	assert.Equal(t, 5, st.Transitions)
+	assert.Equal(t, 3, st.Vocabulary)
+	assert.True(t, st.Bytes > 0)
+}
+
+func TestPrune1(t *testing.T) {
+	ss := []string{"a b c", "a b c", "a b d", "x y"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	before, err := c.Stats()
+	assert.NoError(t, err)
+
+	assert.NoError(t, c.Prune(PruneOptions{MinCount: 2}))
+	after, err := c.Stats()
+	assert.NoError(t, err)
+	assert.True(t, after.Suffixes < before.Suffixes)
+	assert.Equal(t, c.store.Len(), len(c.keys))
+	sx, err := c.store.Get(Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []Suffix{{true, NOSOURCE, "c", 0}, {true, NOSOURCE, "c", 0}}, sx)
+	assert.Empty(t, c.index["y"])
+	assert.NotEmpty(t, c.index["a"])
+	s, err := c.GenerateAnswer("b", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "b c", s)
+}
+
+func TestPrune2(t *testing.T) {
+	ss := []string{"a b c", "a b c", "a b d", "a b e", "a b e", "a b e"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	assert.NoError(t, c.Prune(PruneOptions{MaxSuffixes: 2}))
+	ts := c.transitions(Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2})
+	assert.Equal(t, []string{"c", "e"}, []string{ts[0].word, ts[1].word})
+	assert.Len(t, ts, 2)
+
+	assert.NoError(t, c.Prune(PruneOptions{DropSingle: true}))
+	assert.Len(t, c.keys, 2)
+	assert.True(t, c.keys[0].isStart())
+
+	c = NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	assert.NoError(t, c.Prune(PruneOptions{MaxVocabulary: 4}))
+	st, err := c.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, st.Vocabulary)
+	ts = c.transitions(Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2})
+	assert.Len(t, ts, 1)
+	assert.Equal(t, "e", ts[0].word)
+}
@@ -0,0 +1,84 @@
+package xrich
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+//DatedText is text block with time when it was written
+type DatedText struct {
+	Text string
+	Date time.Time // zero if time is unknown
+}
+
+//BuildDated build states transition table from dated text blocks like `BuildParallel`.
+//Transitions are weighted by age of their text blocks when half-life is set by `SetHalfLife`.
+func (r *MarkovChain) BuildDated(blocks []DatedText, workers int) error {
+	textBlocks := make([]string, len(blocks))
+	dates := make([]int64, len(blocks))
+	for i, b := range blocks {
+		textBlocks[i] = b.Text
+		if !b.Date.IsZero() {
+			dates[i] = b.Date.Unix()
+		}
+	}
+	return r.buildParallel(textBlocks, dates, workers)
+}
+
+//SetHalfLife set age of transition which halves its weight, so generation, scores and predictions including backoff
+//follow recent text blocks and old transitions fade out. Age is counted from latest dated text block of chain,
+//transitions of undated text blocks are weighted as latest ones. Zero half-life disables weighting.
+//Half-life must be set before store of chain built earlier. Weights only change how likely transitions are,
+//faded transitions stay in chain until they are removed by `Prune` with MinWeight.
+func (r *MarkovChain) SetHalfLife(d time.Duration) {
+	r.halfLife = d
+	r.lower = nil
+}
+
+//findLatest set latest date of chain by dates of suffixes of store
+func (r *MarkovChain) findLatest() error {
+	r.latest = 0
+	for _, p := range r.keys {
+		sx, err := r.store.Get(*p)
+		if err != nil {
+			return &StoreError{Op: "get", Err: err}
+		}
+		for _, s := range sx {
+			if s.date > r.latest {
+				r.latest = s.date
+			}
+		}
+	}
+	return nil
+}
+
+//weightFunc return weight of suffix by its age or nil if transitions are not weighted
+func (r *MarkovChain) weightFunc() func(s Suffix) float64 {
+	if r.halfLife <= 0 {
+		return nil
+	}
+	halfLife, latest := r.halfLife.Seconds(), r.latest
+	return func(s Suffix) float64 {
+		if s.date == 0 || s.date >= latest {
+			return 1
+		}
+		return math.Exp2(-float64(latest-s.date) / halfLife)
+	}
+}
+
+//sampleWeighted return suffix of `sx` chosen with probability proportional to its weight by `weight`
+func sampleWeighted(sx []Suffix, weight func(s Suffix) float64, rnd *rand.Rand) Suffix {
+	var total float64
+	for _, s := range sx {
+		total += weight(s)
+	}
+	x := rnd.Float64() * total
+	for _, s := range sx {
+		x -= weight(s)
+		if x < 0 {
+			return s
+		}
+	}
+	return sx[len(sx)-1]
+}
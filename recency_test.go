@@ -0,0 +1,46 @@
+package xrich
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildDated1(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	blocks := []DatedText{
+		{Text: "a b c", Date: now.AddDate(-3, 0, 0)},
+		{Text: "a b d", Date: now},
+		{Text: "a b e"},
+	}
+	p := Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2}
+	c := NewMarkovChain()
+	assert.NoError(t, c.BuildDated(blocks, 2))
+	assert.Equal(t, now.Unix(), c.latest)
+	assert.InDelta(t, 1.0/3, c.transitionProb(p, "c"), 1e-9)
+
+	c.SetHalfLife(30 * 24 * time.Hour)
+	assert.InDelta(t, 0, c.transitionProb(p, "c"), 1e-9)
+	assert.InDelta(t, 0.5, c.transitionProb(p, "d"), 1e-9)
+	c.policy.init(&c)
+	for i := 0; i < 100; i++ {
+		s, _, ok := c.findSuffix(p)
+		assert.True(t, ok)
+		assert.NotEqual(t, "c", s.word)
+	}
+	// backoff of unknown prefix is weighted too
+	ps, err := c.Predict([]string{"x", "b"}, 3)
+	assert.NoError(t, err)
+	if assert.Len(t, ps, 3) {
+		assert.Equal(t, "d", ps[0].Word)
+		assert.InDelta(t, 0.5, ps[0].Prob, 1e-9)
+		assert.Equal(t, "c", ps[2].Word)
+		assert.InDelta(t, 0, ps[2].Prob, 1e-9)
+	}
+
+	assert.NoError(t, c.Prune(PruneOptions{MinWeight: 0.01}))
+	sx, err := c.store.Get(p)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "e"}, suffixWords(sx))
+}
@@ -0,0 +1,108 @@
+package xrich
+
+import "fmt"
+
+//StopReason describe why generation of text was stopped
+type StopReason int
+
+const (
+	//StopNone means that generation was not started
+	StopNone StopReason = iota
+	//StopLength means that limit of words or characters was reached and text was cut on last end of sentence
+	StopLength
+	//StopDeadEnd means that chain has no transitions for current prefix
+	StopDeadEnd
+	//StopPhraseEnd means that phrase was ended by NONWORD
+	StopPhraseEnd
+	//StopSentenceEnd means that sentence was ended by punctuation
+	StopSentenceEnd
+	//StopConsumer means that generation was stopped by consumer of stream
+	StopConsumer
+	//StopRepeat means that only recently generated texts were generated and they were rejected by novelty policy
+	StopRepeat
+	//StopBlocked means that only texts with blocked content were generated and they were rejected by content filter
+	StopBlocked
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopNone:
+		return "none"
+	case StopLength:
+		return "length"
+	case StopDeadEnd:
+		return "dead end"
+	case StopPhraseEnd:
+		return "phrase end"
+	case StopSentenceEnd:
+		return "sentence end"
+	case StopConsumer:
+		return "consumer"
+	case StopRepeat:
+		return "repeat"
+	case StopBlocked:
+		return "blocked"
+	}
+	return fmt.Sprintf("StopReason(%d)", int(r))
+}
+
+//Result is generated text with details of generation
+type Result struct {
+	Tokens  []string
+	Text    string
+	Trigger string // word of message which triggered answer
+	Stop    StopReason
+	LogProb float64 // log-probability of transitions which produced tokens
+	Spans   []Span  // source text blocks of tokens
+	Err     error
+}
+
+//newResult return result for generated text `g`
+func (r *MarkovChain) newResult(g generated) Result {
+	res := Result{
+		Tokens:  suffixWords(g.words),
+		Stop:    g.stop,
+		LogProb: g.logProb,
+		Spans:   spans(g.words),
+	}
+	res.Text = r.join(res.Tokens)
+	if len(res.Tokens) == 0 {
+		res.Err = ErrNoText
+		switch g.stop {
+		case StopRepeat:
+			res.Err = ErrRepeated
+		case StopBlocked:
+			res.Err = ErrBlocked
+		}
+	}
+	if err := r.takeErr(); err != nil {
+		res.Err = err
+	}
+	return res
+}
+
+//GenerateSentenceResult return text generated with length controlled by options `opts` and details of generation
+func (r *MarkovChain) GenerateSentenceResult(opts GenerateOptions) Result {
+	if r.isEmpty() {
+		return Result{Err: ErrEmptyChain}
+	}
+	return r.newResult(r.generateSentence(opts, nil))
+}
+
+//GenerateAnswerResult return answer for text `message` generated with length controlled by options `opts` and details of generation
+func (r *MarkovChain) GenerateAnswerResult(message string, opts GenerateOptions) Result {
+	if r.isEmpty() {
+		return Result{Err: ErrEmptyChain}
+	}
+	g, trigger, err := r.answer(message, r.answerGenerator(opts))
+	if err != nil {
+		r.takeErr()
+		return Result{Err: err}
+	}
+	res := r.newResult(g)
+	res.Trigger = trigger
+	if trigger == "" && res.Err == ErrNoText {
+		res.Err = ErrNoAnswer
+	}
+	return res
+}
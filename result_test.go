@@ -0,0 +1,49 @@
+package xrich
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSentenceResult1(t *testing.T) {
+	ss := []string{"a b c", "a b d"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	res := c.GenerateSentenceResult(GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, []string{"a", "b", "c"}, res.Tokens)
+	assert.Equal(t, "a b c", res.Text)
+	assert.Equal(t, StopPhraseEnd, res.Stop)
+	assert.InDelta(t, math.Log(0.5), res.LogProb, 1e-9)
+
+	res = c.GenerateSentenceResult(GenerateOptions{MaxWords: 2})
+	assert.Equal(t, ErrNoText, res.Err)
+	assert.Equal(t, StopLength, res.Stop)
+	assert.Empty(t, res.Text)
+}
+
+func TestSentenceResult2(t *testing.T) {
+	c := NewMarkovChain()
+	res := c.GenerateSentenceResult(GenerateOptions{})
+	assert.Equal(t, ErrEmptyChain, res.Err)
+	assert.Equal(t, StopNone, res.Stop)
+}
+
+func TestAnswerResult1(t *testing.T) {
+	ss := []string{"a b c", "a b d"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	res := c.GenerateAnswerResult("zzz b", GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, "b c", res.Text)
+	assert.Equal(t, "b", res.Trigger)
+	assert.Equal(t, StopPhraseEnd, res.Stop)
+
+	res = c.GenerateAnswerResult("zzz", GenerateOptions{StopAtEnd: true})
+	assert.Equal(t, ErrNoAnswer, res.Err)
+	assert.Equal(t, "", res.Trigger)
+}
@@ -0,0 +1,101 @@
+package xrich
+
+import "math"
+
+//SMOOTHING is weight of lower order distribution mixed into transition probabilities of unseen and rare transitions
+const SMOOTHING = 1.0
+
+//TokenScore is probability of token under chain given preceding tokens
+type TokenScore struct {
+	Word string
+	Prob float64
+	Seen bool // transition is present in states transition table
+}
+
+//TextScore is likelihood of text under chain
+type TextScore struct {
+	Tokens  []TokenScore
+	LogProb float64
+}
+
+//unigramProb return probability of single word smoothed with uniform distribution over known words and one unknown word
+func (lo *lowerOrder) unigramProb(word string) float64 {
+	uniform := 1 / float64(len(lo.unigrams)+1)
+	return (lo.unigrams[word] + SMOOTHING*uniform) / (lo.total + SMOOTHING)
+}
+
+//bigramProb return probability of word following word `last` smoothed with unigram distribution
+func (lo *lowerOrder) bigramProb(last string, word string) float64 {
+	return (lo.bigrams[last][word] + SMOOTHING*lo.unigramProb(word)) / (lo.bitotals[last] + SMOOTHING)
+}
+
+//tokenProb return smoothed probability of transition from prefix `p` to `word` and whether this transition was seen
+func (r *MarkovChain) tokenProb(p Prefix, word string) (float64, bool) {
+	lo := r.lowerOrder()
+	pb := lo.bigramProb(p.last(), word)
+
+	// start of phrase is described by bigrams of NONWORD
+	if p.isStart() {
+		return pb, lo.bigrams[NONWORD][word] > 0
+	}
+
+	// suffixes are counted by their weights like in backoff
+	sx := r.suffixes(p)
+	weight := r.weightFunc()
+	var count, total float64
+	seen := false
+	for _, s := range sx {
+		w := 1.0
+		if weight != nil {
+			w = weight(s)
+		}
+		total += w
+		if s.word == word {
+			count += w
+			seen = true
+		}
+	}
+	return (count + SMOOTHING*pb) / (total + SMOOTHING), seen
+}
+
+//Score return log-probability of text `text` and probabilities of its tokens including end of phrase.
+//Text is tokenized in same way as in `Build`.
+func (r *MarkovChain) Score(text string) (res TextScore, err error) {
+	words, err := r.tokenize(text)
+	if err != nil {
+		return res, err
+	}
+	if len(words) == 0 {
+		return res, nil
+	}
+	words = append(words, NONWORD)
+
+	prefix := r.startPrefix()
+	for _, w := range words {
+		p, seen := r.tokenProb(prefix, w)
+		res.Tokens = append(res.Tokens, TokenScore{Word: w, Prob: p, Seen: seen})
+		res.LogProb += math.Log(p)
+		prefix.lshift()
+		prefix.put(w)
+	}
+	return res, r.takeErr()
+}
+
+//Perplexity return perplexity of chain on text blocks `textBlocks`, i.e. exp of average negative log-probability of token.
+//Return NaN and ErrNoTokens if text blocks contain no tokens.
+func (r *MarkovChain) Perplexity(textBlocks []string) (float64, error) {
+	var logProb float64
+	var ntokens int
+	for _, s := range textBlocks {
+		ts, err := r.Score(s)
+		if err != nil {
+			return math.NaN(), err
+		}
+		logProb += ts.LogProb
+		ntokens += len(ts.Tokens)
+	}
+	if ntokens == 0 {
+		return math.NaN(), ErrNoTokens
+	}
+	return math.Exp(-logProb / float64(ntokens)), nil
+}
@@ -0,0 +1,57 @@
+package xrich
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScore1(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	s, err := c.Score("a b c")
+	assert.NoError(t, err)
+	if assert.Len(t, s.Tokens, 4) {
+		assert.Equal(t, "a", s.Tokens[0].Word)
+		assert.Equal(t, NONWORD, s.Tokens[3].Word)
+		for _, ts := range s.Tokens {
+			assert.True(t, ts.Seen)
+		}
+	}
+	s2, err := c.Score("a b x")
+	assert.NoError(t, err)
+	assert.False(t, s2.Tokens[2].Seen)
+	assert.True(t, s2.Tokens[2].Prob > 0)
+	assert.True(t, s.LogProb > s2.LogProb)
+}
+
+func TestScore2(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	// probabilities of all known words and one unknown word sum to one
+	p, err := newPrefix("a", "b")
+	assert.NoError(t, err)
+	sum, _ := c.tokenProb(*p, "x")
+	for w := range c.lowerOrder().unigrams {
+		prob, _ := c.tokenProb(*p, w)
+		sum += prob
+	}
+	assert.InDelta(t, 1, sum, 1e-9)
+}
+
+func TestPerplexity1(t *testing.T) {
+	ss := []string{"a b c", "a b d", "a b c"}
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build(ss))
+	pp1, err := c.Perplexity(ss)
+	assert.NoError(t, err)
+	pp2, err := c.Perplexity([]string{"d c b a"})
+	assert.NoError(t, err)
+	assert.True(t, pp1 < pp2)
+	pp, err := c.Perplexity([]string{""})
+	assert.Equal(t, ErrNoTokens, err)
+	assert.True(t, math.IsNaN(pp))
+}
@@ -0,0 +1,220 @@
+package xrich
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+//StateStore keep states transitions table of chain, i.e. suffixes of every prefix in order of addition.
+//Store of chain is set by `SetStateStore`, by default chain keep table in memory by `MapStore`.
+type StateStore interface {
+	//Get return suffixes of prefix `p` or nil if prefix is unknown
+	Get(p Prefix) ([]Suffix, error)
+	//Append add suffix `s` to suffixes of prefix `p` and return true if prefix was unknown
+	Append(p Prefix, s Suffix) (bool, error)
+	//Set replace suffixes of prefix `p` by `sx`, prefix is removed if `sx` is empty
+	Set(p Prefix, sx []Suffix) error
+	//Len return number of prefixes
+	Len() int
+	//Range call `f` for every prefix in order of addition until `f` return false
+	Range(f func(p Prefix) bool) error
+}
+
+//MapStore keep states transitions table in memory
+type MapStore struct {
+	statetab map[Prefix]mapEntry
+	seq      int // sequence number of next added prefix
+}
+
+//mapEntry is suffixes of prefix with sequence number of its addition, so prefixes are ordered without list of them
+type mapEntry struct {
+	sx  []Suffix
+	seq int
+}
+
+//NewMapStore create new empty in-memory store
+func NewMapStore() *MapStore {
+	return &MapStore{statetab: make(map[Prefix]mapEntry)}
+}
+
+//Get return suffixes of prefix `p` or nil if prefix is unknown
+func (r *MapStore) Get(p Prefix) ([]Suffix, error) {
+	return r.statetab[p].sx, nil
+}
+
+//Append add suffix `s` to suffixes of prefix `p` and return true if prefix was unknown
+func (r *MapStore) Append(p Prefix, s Suffix) (bool, error) {
+	return r.appendAll(p, []Suffix{s})
+}
+
+//Set replace suffixes of prefix `p` by `sx`, prefix is removed if `sx` is empty
+func (r *MapStore) Set(p Prefix, sx []Suffix) error {
+	e, ok := r.statetab[p]
+	if len(sx) == 0 {
+		delete(r.statetab, p)
+		return nil
+	}
+	if !ok {
+		e.seq = r.nextSeq()
+	}
+	e.sx = append([]Suffix(nil), sx...)
+	r.statetab[p] = e
+	return nil
+}
+
+//nextSeq return sequence number of added prefix
+func (r *MapStore) nextSeq() int {
+	r.seq++
+	return r.seq
+}
+
+//appendAll add suffixes `sx` to suffixes of prefix `p` and return true if prefix was unknown
+func (r *MapStore) appendAll(p Prefix, sx []Suffix) (bool, error) {
+	e, ok := r.statetab[p]
+	if !ok {
+		e.seq = r.nextSeq()
+	}
+	e.sx = append(e.sx, sx...)
+	r.statetab[p] = e
+	return !ok, nil
+}
+
+//Len return number of prefixes
+func (r *MapStore) Len() int {
+	return len(r.statetab)
+}
+
+//Range call `f` for every prefix in order of addition until `f` return false.
+//Prefixes are sorted by sequence numbers of their addition on every call.
+func (r *MapStore) Range(f func(p Prefix) bool) error {
+	keys := make([]orderedPrefix, 0, len(r.statetab))
+	for p, e := range r.statetab {
+		keys = append(keys, orderedPrefix{p, int64(e.seq)})
+	}
+	rangeOrdered(keys, f)
+	return nil
+}
+
+//orderedPrefix is prefix with position of its addition to store
+type orderedPrefix struct {
+	prefix Prefix
+	pos    int64
+}
+
+//rangeOrdered call `f` for every prefix of `keys` in order of positions until `f` return false
+func rangeOrdered(keys []orderedPrefix, f func(p Prefix) bool) {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].pos < keys[j].pos })
+	for _, k := range keys {
+		if !f(k.prefix) {
+			break
+		}
+	}
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutUvarint(buf[:], uint64(len(s)))])
+	b.WriteString(s)
+}
+
+func readString(rd *bytes.Reader) (string, error) {
+	n, err := binary.ReadUvarint(rd)
+	if err != nil {
+		return "", ErrCorrupted
+	}
+	if n > uint64(rd.Len()) {
+		return "", ErrCorrupted
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rd, buf); err != nil {
+		return "", ErrCorrupted
+	}
+	return string(buf), nil
+}
+
+//MarshalBinary encode prefix into binary form which is used by persistent stores
+func (r Prefix) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	r.encode(&b)
+	return b.Bytes(), nil
+}
+
+func (r Prefix) encode(b *bytes.Buffer) {
+	b.WriteByte(byte(r.n))
+	for i := 0; i < r.n; i++ {
+		writeString(b, r.words[i])
+	}
+}
+
+//UnmarshalBinary decode prefix encoded by `MarshalBinary`
+func (r *Prefix) UnmarshalBinary(data []byte) error {
+	return r.decode(bytes.NewReader(data))
+}
+
+func (r *Prefix) decode(rd *bytes.Reader) error {
+	n, err := rd.ReadByte()
+	if err != nil || n < 1 || n > MAXNPREF {
+		return ErrCorrupted
+	}
+	*r = Prefix{n: int(n)}
+	for i := 0; i < r.n; i++ {
+		if r.words[i], err = readString(rd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//MarshalBinary encode suffix into binary form which is used by persistent stores
+func (r Suffix) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	r.encode(&b)
+	return b.Bytes(), nil
+}
+
+func (r Suffix) encode(b *bytes.Buffer) {
+	var flags byte
+	if r.sol {
+		flags |= 1
+	}
+	if r.date != 0 {
+		flags |= 2
+	}
+	b.WriteByte(flags)
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutVarint(buf[:], int64(r.src))])
+	writeString(b, r.word)
+	if r.date != 0 {
+		b.Write(buf[:binary.PutVarint(buf[:], r.date)])
+	}
+}
+
+//UnmarshalBinary decode suffix encoded by `MarshalBinary`
+func (r *Suffix) UnmarshalBinary(data []byte) error {
+	return r.decode(bytes.NewReader(data))
+}
+
+func (r *Suffix) decode(rd *bytes.Reader) error {
+	flags, err := rd.ReadByte()
+	if err != nil {
+		return ErrCorrupted
+	}
+	src, err := binary.ReadVarint(rd)
+	if err != nil {
+		return ErrCorrupted
+	}
+	word, err := readString(rd)
+	if err != nil {
+		return err
+	}
+	var date int64
+	if flags&2 != 0 {
+		if date, err = binary.ReadVarint(rd); err != nil {
+			return ErrCorrupted
+		}
+	}
+	*r = Suffix{sol: flags&1 != 0, src: int32(src), word: word, date: date}
+	return nil
+}
@@ -0,0 +1,252 @@
+package xrich
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore1(t *testing.T) {
+	ss := []string{"a b c b", "b c d"}
+	path := filepath.Join(t.TempDir(), "chain.db")
+	fs, err := OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.SetStateStore(fs))
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateSentence(6)
+	assert.NoError(t, err)
+	assert.Equal(t, "a b c b . a", s)
+	assert.NoError(t, fs.Close())
+
+	// knowledge of chain persist after reopening
+	fs, err = OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fs.Close()
+	c2 := NewMarkovChain()
+	c2.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c2.SetStateStore(fs))
+	assert.Equal(t, c.keys, c2.keys)
+	assert.Len(t, c2.index["b"], len(c.index["b"]))
+	sx, err := fs.Get(Prefix{words: [MAXNPREF]string{"b", "c"}, n: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []Suffix{{true, NOSOURCE, "b", 0}, {true, NOSOURCE, "d", 0}}, sx)
+	s, err = c2.GenerateAnswer("b", 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "b c b", s)
+}
+
+func TestFileStore2(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	fs, err := OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := NewMarkovChain()
+	assert.NoError(t, c.SetStateStore(fs))
+	assert.NoError(t, c.Build([]string{"a b c"}))
+	assert.NoError(t, fs.Close())
+
+	// record written partially by crash is discarded
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(path, info.Size()-2))
+	fs, err = OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fs.Close()
+	assert.Equal(t, 3, fs.Len())
+	sx, err := fs.Get(Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []Suffix{{true, NOSOURCE, "c", 0}}, sx)
+	sx, err = fs.Get(Prefix{words: [MAXNPREF]string{"b", "c"}, n: 2})
+	assert.NoError(t, err)
+	assert.Nil(t, sx)
+}
+
+func TestFileStore3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	assert.NoError(t, os.WriteFile(path, []byte("not a chain"), 0644))
+	_, err := OpenFileStore(path)
+	assert.Equal(t, ErrCorrupted, err)
+}
+
+func TestFileStore6(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	fs, err := OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := NewMarkovChain()
+	assert.NoError(t, c.SetStateStore(fs))
+	assert.NoError(t, c.Build([]string{"a b c"}))
+	assert.NoError(t, fs.Close())
+
+	// damaged record in middle of file is not discarded with following records
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data[len(fileMagic)+recordHeaderSize+1] ^= 0xff
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+	_, err = OpenFileStore(path)
+	assert.Equal(t, ErrCorrupted, err)
+	after, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, data, after)
+}
+
+func TestBinary1(t *testing.T) {
+	p := Prefix{words: [MAXNPREF]string{"кот", NONWORD, ""}, n: 3}
+	data, err := p.MarshalBinary()
+	assert.NoError(t, err)
+	var p2 Prefix
+	assert.NoError(t, p2.UnmarshalBinary(data))
+	assert.Equal(t, p, p2)
+
+	s := Suffix{sol: true, src: 42, word: "спит", date: 1600000000}
+	data, err = s.MarshalBinary()
+	assert.NoError(t, err)
+	var s2 Suffix
+	assert.NoError(t, s2.UnmarshalBinary(data))
+	assert.Equal(t, s, s2)
+	assert.Equal(t, ErrCorrupted, s2.UnmarshalBinary(data[:len(data)-1]))
+}
+
+func TestFileStore4(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	fs, err := OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := NewMarkovChain()
+	assert.NoError(t, c.SetStateStore(fs))
+	assert.NoError(t, c.Build([]string{"a b c", "a b c", "a b d", "x y"}))
+	assert.NoError(t, c.Prune(PruneOptions{MinCount: 2}))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, fs.Compact())
+	compacted, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.True(t, compacted.Size() < info.Size())
+	assert.NoError(t, fs.Close())
+
+	// replaced and removed suffixes are same after compaction and reopening
+	fs, err = OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fs.Close()
+	assert.Equal(t, len(c.keys), fs.Len())
+	sx, err := fs.Get(Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []Suffix{{true, NOSOURCE, "c", 0}, {true, NOSOURCE, "c", 0}}, sx)
+	sx, err = fs.Get(Prefix{words: [MAXNPREF]string{"x", "y"}, n: 2})
+	assert.NoError(t, err)
+	assert.Nil(t, sx)
+}
+
+func TestMapStoreSet1(t *testing.T) {
+	s := NewMapStore()
+	p := Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2}
+	q := Prefix{words: [MAXNPREF]string{"b", "c"}, n: 2}
+	s.Append(p, Suffix{word: "c"})
+	s.Append(q, Suffix{word: "d"})
+	assert.NoError(t, s.Set(p, nil))
+	assert.Equal(t, 1, s.Len())
+	isNew, err := s.Append(p, Suffix{word: "e"})
+	assert.NoError(t, err)
+	assert.True(t, isNew)
+	var keys []Prefix
+	s.Range(func(p Prefix) bool {
+		keys = append(keys, p)
+		return true
+	})
+	assert.Equal(t, []Prefix{q, p}, keys)
+}
+
+func TestFileStore7(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	fs, err := OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2}
+	q := Prefix{words: [MAXNPREF]string{"b", "c"}, n: 2}
+	fs.Append(p, Suffix{word: "c"})
+	fs.Append(q, Suffix{word: "d"})
+	assert.NoError(t, fs.Set(q, []Suffix{{word: "e"}}))
+	assert.NoError(t, fs.Set(p, nil))
+	fs.Append(p, Suffix{word: "e"})
+	assert.NoError(t, fs.Close())
+
+	// prefix which was removed and added again follows prefixes added before it after reopening
+	fs, err = OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fs.Close()
+	var keys []Prefix
+	fs.Range(func(p Prefix) bool {
+		keys = append(keys, p)
+		return true
+	})
+	assert.Equal(t, []Prefix{q, p}, keys)
+}
+
+func TestFileStore5(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	fs, err := OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := NewMarkovChain()
+	assert.NoError(t, c.SetStateStore(fs))
+	date := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, c.BuildDated([]DatedText{{Text: "a b c", Date: date}}, 1))
+	assert.NoError(t, fs.Close())
+
+	// latest date is restored from reopened store
+	fs, err = OpenFileStore(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer fs.Close()
+	c = NewMarkovChain()
+	c.SetHalfLife(time.Hour)
+	assert.NoError(t, c.SetStateStore(fs))
+	assert.Equal(t, date.Unix(), c.latest)
+}
+
+//countingStore count reads of suffixes of store
+type countingStore struct {
+	*MapStore
+	gets int
+}
+
+func (r *countingStore) Get(p Prefix) ([]Suffix, error) {
+	r.gets++
+	return r.MapStore.Get(p)
+}
+
+func TestStateStoreGet1(t *testing.T) {
+	s := &countingStore{MapStore: NewMapStore()}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.SetStateStore(s))
+	assert.NoError(t, c.Build([]string{"a b c d"}))
+
+	// suffixes are read once for every generated word, probability of word is taken from them
+	s.gets = 0
+	res := c.GenerateSentenceResult(GenerateOptions{MaxSentences: 1})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, "a b c d", res.Text)
+	assert.Equal(t, 5, s.gets)
+}
@@ -0,0 +1,114 @@
+package xrich
+
+import (
+	"bufio"
+	"strings"
+)
+
+//StreamSentence generate text with length controlled by options `opts` and pass every token to `yield`
+//as soon as it is generated. Generation is stopped when `yield` return false.
+//Unlike `GenerateSentenceOpts` streamed text is not cut on last end of sentence.
+//Return details of generation with all streamed tokens.
+func (r *MarkovChain) StreamSentence(opts GenerateOptions, yield func(token string) bool) Result {
+	if r.isEmpty() {
+		return Result{Err: ErrEmptyChain}
+	}
+	return r.newResult(r.generateSentence(opts, func(s Suffix) bool {
+		return yield(s.word)
+	}))
+}
+
+//StreamAnswer generate answer for text `message` and pass every token to `yield` as soon as it is generated.
+//Unlike `GenerateAnswerResult` prefix of answer is chosen among prefixes of words of message before generation,
+//so streamed answer is not chosen among generated phrases and is not generated again by novelty policy
+//or content filter. Generation is stopped when `yield` return false. Return details of whole answer.
+func (r *MarkovChain) StreamAnswer(message string, opts GenerateOptions, yield func(token string) bool) Result {
+	if r.isEmpty() {
+		return Result{Err: ErrEmptyChain}
+	}
+	r.policy.init(r)
+	starts, err := r.answerStarts(message)
+	if err != nil {
+		r.takeErr()
+		return Result{Err: err}
+	}
+	if len(starts) == 0 {
+		res := r.newResult(generated{})
+		if res.Err == ErrNoText {
+			res.Err = ErrNoAnswer
+		}
+		return res
+	}
+	start := starts[r.policy.findTriggerPrefix(len(starts))]
+
+	head := sourceless(start.prefix.words[start.from:start.prefix.n]...)
+	for i, s := range head {
+		if !yield(s.word) {
+			res := r.newResult(generated{words: head[:i+1], stop: StopConsumer})
+			res.Trigger = start.trigger
+			return res
+		}
+	}
+	ctx := new(Context)
+	ctx.prefix = start.prefix
+	g := r.generateText(ctx, suffixWords(head), opts, func(s Suffix) bool {
+		return yield(s.word)
+	})
+	r.rememberText(g.words)
+	res := r.newResult(g)
+	res.Trigger = start.trigger
+	return res
+}
+
+//JoinTokens return text of tokens `tokens` joined like generated text, so streamed tokens can be shown as text
+func (r *MarkovChain) JoinTokens(tokens []string) string {
+	return r.join(tokens)
+}
+
+//answerStart is prefix which starts answer for word `trigger` of message,
+//words of prefix starting from position `from` are head of answer
+type answerStart struct {
+	prefix  Prefix
+	from    int
+	trigger string
+}
+
+//answerStarts return prefixes which start answers for words of text `message` like in `answer`:
+//prefix of last words of message if it continues, otherwise prefix with word in any position and any form
+func (r *MarkovChain) answerStarts(message string) ([]answerStart, error) {
+	var starts []answerStart
+	prefix := r.startPrefix()
+	sc := bufio.NewScanner(strings.NewReader(message))
+	sc.Split(r.wordsSplitFunc())
+	for sc.Scan() {
+		w := sc.Text()
+		prefix.lshift()
+		prefix.put(w)
+
+		k := 0
+		for i := 0; i < prefix.n && prefix.words[i] == NONWORD; i++ {
+			k++
+		}
+		if p := r.knownPrefix(prefix); r.continues(p) {
+			starts = append(starts, answerStart{p, k, w})
+			continue
+		}
+		if p, from, ok := r.triggerPrefix(r.norm.Normalize(w)); ok {
+			starts = append(starts, answerStart{p, from, w})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, &ScanError{Block: -1, Err: err}
+	}
+	return starts, nil
+}
+
+//continues return true if prefix `p` has suffix which is not NONWORD
+func (r *MarkovChain) continues(p Prefix) bool {
+	for _, s := range r.suffixes(p) {
+		if s.word != NONWORD {
+			return true
+		}
+	}
+	return false
+}
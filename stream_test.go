@@ -0,0 +1,82 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamSentence1(t *testing.T) {
+	ss := []string{"a b c", "d e"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	var tokens []string
+	res := c.StreamSentence(GenerateOptions{MaxWords: 6}, func(token string) bool {
+		tokens = append(tokens, token)
+		return true
+	})
+	assert.Equal(t, []string{"a", "b", "c", SEP, "a", "b"}, tokens)
+	assert.Equal(t, tokens, res.Tokens)
+	assert.Equal(t, StopLength, res.Stop)
+	assert.Equal(t, res.Text, c.JoinTokens(tokens))
+}
+
+func TestStreamSentence2(t *testing.T) {
+	ss := []string{"a b c", "d e"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	var tokens []string
+	res := c.StreamSentence(GenerateOptions{}, func(token string) bool {
+		tokens = append(tokens, token)
+		return len(tokens) < 2
+	})
+	assert.Equal(t, []string{"a", "b"}, tokens)
+	assert.Equal(t, "a b", res.Text)
+	assert.Equal(t, StopConsumer, res.Stop)
+}
+
+func TestStreamAnswer1(t *testing.T) {
+	ss := []string{"a b c", "d e"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	var tokens []string
+	res := c.StreamAnswer("d", GenerateOptions{StopAtEnd: true}, func(token string) bool {
+		tokens = append(tokens, token)
+		return true
+	})
+	assert.Equal(t, []string{"d", "e"}, tokens)
+	assert.Equal(t, StopPhraseEnd, res.Stop)
+}
+
+func TestStreamAnswer2(t *testing.T) {
+	ss := []string{"a b c d e f"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	var tokens []string
+	res := c.StreamAnswer("x b", GenerateOptions{}, func(token string) bool {
+		tokens = append(tokens, token)
+		return len(tokens) < 3
+	})
+	assert.Equal(t, []string{"b", "c", "d"}, tokens)
+	assert.Equal(t, tokens, res.Tokens)
+	assert.Equal(t, "b", res.Trigger)
+	assert.Equal(t, StopConsumer, res.Stop)
+}
+
+func TestStreamMaxChars1(t *testing.T) {
+	ss := []string{"aa bb cc dd"}
+	c := NewMarkovChain()
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	var tokens []string
+	res := c.StreamSentence(GenerateOptions{MaxChars: 7}, func(token string) bool {
+		tokens = append(tokens, token)
+		return true
+	})
+	assert.Equal(t, []string{"aa", "bb"}, tokens)
+	assert.Equal(t, "aa bb", res.Text)
+}
@@ -0,0 +1,90 @@
+package xrich
+
+import (
+	"bufio"
+	"strings"
+)
+
+//TopicBias boost candidates of next word which are keywords of topic or lead to them by next transition,
+//so whole generated text drifts towards topic while it still follows transitions of chain.
+//Score of candidate is weight of its word as keyword plus weights of keywords which follow it
+//multiplied by their probabilities and Lookahead.
+type TopicBias struct {
+	Boost     float64 // weight of candidate is multiplied by 1 + Boost * score of candidate
+	Lookahead float64 // part of score from keywords which follow candidate, zero disables lookahead
+	chain     *MarkovChain
+	keywords  map[string]float64 // normalized words and their weights
+}
+
+//NewTopicBias return topic bias of chain with boost `boost` and lookahead 0.5 which has no keywords.
+//Bias is applied when its middleware is added to policy by `ComposeGeneratePolicy`.
+func (r *MarkovChain) NewTopicBias(boost float64) *TopicBias {
+	return &TopicBias{Boost: boost, Lookahead: 0.5, chain: r, keywords: make(map[string]float64)}
+}
+
+//SetKeywords set keywords of topic with their weights. Words are matched by normalizer of chain,
+//so normalizer must be set before keywords.
+func (r *TopicBias) SetKeywords(keywords map[string]float64) {
+	r.keywords = make(map[string]float64, len(keywords))
+	for w, weight := range keywords {
+		r.keywords[r.chain.norm.Normalize(w)] += weight
+	}
+}
+
+//SetTexts set keywords of topic to words of texts `texts`, e.g. recent messages of chat.
+//Weight of word is number of its occurrences divided by max number of occurrences of word.
+func (r *TopicBias) SetTexts(texts ...string) {
+	counts := make(map[string]float64)
+	var max float64
+	for _, t := range texts {
+		sc := bufio.NewScanner(strings.NewReader(t))
+		sc.Split(r.chain.wordsSplitFunc())
+		for sc.Scan() {
+			if !isWord(sc.Text()) {
+				continue
+			}
+			key := r.chain.norm.Normalize(sc.Text())
+			counts[key]++
+			if counts[key] > max {
+				max = counts[key]
+			}
+		}
+	}
+	for w := range counts {
+		counts[w] /= max
+	}
+	r.keywords = counts
+}
+
+//Middleware return middleware which multiply weights of candidates by their topic scores
+func (r *TopicBias) Middleware() Middleware {
+	return func(prefix []string, cs []Candidate) []Candidate {
+		if len(r.keywords) == 0 {
+			return cs
+		}
+		for i := range cs {
+			cs[i].Weight *= 1 + r.Boost*r.score(prefix, cs[i].Word)
+		}
+		return cs
+	}
+}
+
+//score return topic score of word `word` which follows words `prefix`
+func (r *TopicBias) score(prefix []string, word string) float64 {
+	if word == NONWORD {
+		return 0
+	}
+	score := r.keywords[r.chain.norm.Normalize(word)]
+	if r.Lookahead == 0 || len(prefix) == 0 {
+		return score
+	}
+	next := Prefix{n: len(prefix)}
+	copy(next.words[:], prefix[1:])
+	next.words[next.n-1] = word
+	for _, t := range r.chain.transitions(next) {
+		if t.word != NONWORD {
+			score += r.Lookahead * t.prob * r.keywords[r.chain.norm.Normalize(t.word)]
+		}
+	}
+	return score
+}
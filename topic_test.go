@@ -0,0 +1,38 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicBias1(t *testing.T) {
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build([]string{"a b c", "a b d", "b d e"}))
+	tb := c.NewTopicBias(10)
+	tb.SetTexts("E e, c")
+	assert.Equal(t, map[string]float64{"e": 1, "c": 0.5}, tb.keywords)
+	assert.Equal(t, 0.5, tb.score([]string{"a", "b"}, "c"))
+	assert.Equal(t, 0.25, tb.score([]string{"a", "b"}, "d"))
+	assert.Equal(t, 0.0, tb.score([]string{"a", "b"}, NONWORD))
+
+	tb.SetKeywords(map[string]float64{"E": 1})
+	assert.Equal(t, 0.0, tb.score([]string{"a", "b"}, "c"))
+	assert.Equal(t, 0.25, tb.score([]string{"a", "b"}, "d"))
+}
+
+func TestTopicBias2(t *testing.T) {
+	c := NewMarkovChain()
+	assert.NoError(t, c.Build([]string{"a b c", "a b d", "b d e"}))
+	tb := c.NewTopicBias(100)
+	tb.SetKeywords(map[string]float64{"e": 1})
+	c.SetGeneratePolicy(ComposeGeneratePolicy(NewRandomGeneratePolicy(1), tb.Middleware()))
+	c.policy.init(&c)
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		s, _, ok := c.findSuffix(Prefix{words: [MAXNPREF]string{"a", "b"}, n: 2})
+		assert.True(t, ok)
+		counts[s.word]++
+	}
+	assert.True(t, counts["d"] > 90, "d is chosen %d times", counts["d"])
+}
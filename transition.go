@@ -0,0 +1,132 @@
+package xrich
+
+//transition is distinct suffix of prefix with number of its occurrences and probability
+type transition struct {
+	word  string
+	count int
+	prob  float64
+}
+
+//countTransitions merge duplicated suffixes into distinct transitions in order of first occurrence
+func countTransitions(sx []Suffix) []transition {
+	return weighTransitions(sx, nil)
+}
+
+//weighTransitions merge duplicated suffixes into distinct transitions like `countTransitions`.
+//Probabilities are proportional to sum of weights of suffixes by `weight` or to counts if it is nil.
+func weighTransitions(sx []Suffix, weight func(s Suffix) float64) []transition {
+	var ts []transition
+	index := make(map[string]int)
+	for _, s := range sx {
+		w := 1.0
+		if weight != nil {
+			w = weight(s)
+		}
+		if i, ok := index[s.word]; ok {
+			ts[i].count++
+			ts[i].prob += w
+			continue
+		}
+		index[s.word] = len(ts)
+		ts = append(ts, transition{word: s.word, count: 1, prob: w})
+	}
+	var total float64
+	for _, t := range ts {
+		total += t.prob
+	}
+	for i := range ts {
+		ts[i].prob /= total
+	}
+	return ts
+}
+
+//transitions return distinct transitions of prefix `p` with its probabilities
+func (r *MarkovChain) transitions(p Prefix) []transition {
+	if tl, ok := r.store.(transitionLister); ok {
+		return tl.transitionsOf(p)
+	}
+	return weighTransitions(r.suffixes(p), r.weightFunc())
+}
+
+//transitionProb return probability of transition from prefix `p` to word `word`
+func (r *MarkovChain) transitionProb(p Prefix, word string) float64 {
+	return suffixProb(r.suffixes(p), word, r.weightFunc())
+}
+
+//suffixProb return share of suffixes `sx` with word `word` weighted by `weight` or by counts if it is nil
+func suffixProb(sx []Suffix, word string, weight func(s Suffix) float64) float64 {
+	var w, total float64
+	for _, s := range sx {
+		sw := 1.0
+		if weight != nil {
+			sw = weight(s)
+		}
+		total += sw
+		if s.word == word {
+			w += sw
+		}
+	}
+	return w / total
+}
+
+//startTransitions return distribution of words which start a phrase, i.e. follow NONWORD
+func (r *MarkovChain) startTransitions() []transition {
+	var sx []Suffix
+	for i := 0; i < r.prefixCount(); i++ {
+		p := r.prefixAt(i)
+		if p.last() != NONWORD {
+			continue
+		}
+		for _, s := range r.suffixes(p) {
+			if s.word != NONWORD {
+				sx = append(sx, s)
+			}
+		}
+	}
+	return weighTransitions(sx, r.weightFunc())
+}
+
+//lowerOrder keep statistics of transitions by last word of prefix and of single words.
+//It is used as backoff when prefix is short or unknown. Transitions are counted by their weights
+//if they are weighted by age, so backoff follows recent text blocks like transitions of prefixes.
+type lowerOrder struct {
+	bigrams  map[string]map[string]float64
+	bitotals map[string]float64
+	unigrams map[string]float64
+	total    float64
+}
+
+//lowerOrder return backoff statistics of chain, building them on first use after change of chain
+func (r *MarkovChain) lowerOrder() *lowerOrder {
+	if r.lower != nil {
+		return r.lower
+	}
+	lo := &lowerOrder{
+		bigrams:  make(map[string]map[string]float64),
+		bitotals: make(map[string]float64),
+		unigrams: make(map[string]float64),
+	}
+	weight := r.weightFunc()
+	for i := 0; i < r.prefixCount(); i++ {
+		p := r.prefixAt(i)
+		sx := r.suffixes(p)
+		last := p.last()
+		bi, ok := lo.bigrams[last]
+		if !ok {
+			bi = make(map[string]float64)
+			lo.bigrams[last] = bi
+		}
+		for _, s := range sx {
+			w := 1.0
+			if weight != nil {
+				w = weight(s)
+			}
+			bi[s.word] += w
+			lo.bitotals[last] += w
+			lo.unigrams[s.word] += w
+			lo.total += w
+		}
+	}
+	r.lower = lo
+	return lo
+}
@@ -0,0 +1,181 @@
+package xrich
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+//quotePairs map opening quotes and brackets to closing ones
+var quotePairs = map[string]string{
+	"«":  "»",
+	"„":  "“",
+	"“":  "”",
+	"\"": "\"",
+	"(":  ")",
+	"[":  "]",
+	"{":  "}",
+}
+
+//quoteClosers is set of closing quotes and brackets
+var quoteClosers = func() map[string]bool {
+	m := make(map[string]bool, len(quotePairs))
+	for _, c := range quotePairs {
+		m[c] = true
+	}
+	return m
+}()
+
+//SetTypography enable typography-aware punctuation: runs of terminators like "?!" or "..." and dashes like "—"
+//are single tokens, punctuation token never continues into word, quotes and brackets of generated text are balanced
+//and text is joined by rules of typography instead of spaces between all tokens.
+//It must be set before `Build` and match setting of chain which was stored.
+func (r *MarkovChain) SetTypography(enabled bool) {
+	r.typography = enabled
+}
+
+//isTerminator return true if rune `c` can finish sentence
+func isTerminator(c rune) bool {
+	switch c {
+	case '.', '!', '?', '…':
+		return true
+	}
+	return false
+}
+
+//isDash return true if rune `c` is hyphen or dash
+func isDash(c rune) bool {
+	switch c {
+	case '-', '‐', '‒', '–', '—', '―':
+		return true
+	}
+	return false
+}
+
+//scanPunctRun return punctuation token which starts at position `start` of `data`.
+//Runs of terminators and runs of dashes are single tokens, other punctuation is token of one rune.
+func scanPunctRun(data []byte, start int, atEOF bool) (advance int, token []byte, err error) {
+	first, width := utf8.DecodeRune(data[start:])
+	var same func(c rune) bool
+	switch {
+	case isTerminator(first):
+		same = isTerminator
+	case isDash(first):
+		same = isDash
+	default:
+		return start + width, data[start : start+width], nil
+	}
+	for i := start + width; i < len(data); {
+		c, w := utf8.DecodeRune(data[i:])
+		if !same(c) {
+			return i, data[start:i], nil
+		}
+		i += w
+	}
+	if !atEOF {
+		// Request more data, run can continue.
+		return start, nil, nil
+	}
+	return len(data), data[start:], nil
+}
+
+//quoteRole is role of token in balance of quotes and brackets
+type quoteRole int
+
+const (
+	quoteNone quoteRole = iota
+	quoteOpen
+	quoteClose
+	// quoteUnmatched is closing quote or bracket which does not close last open one
+	quoteUnmatched
+)
+
+//quoteTracker track quotes and brackets which are open in text
+type quoteTracker struct {
+	open []string
+}
+
+//add update open quotes and brackets by token `s` and return its role
+func (t *quoteTracker) add(s string) quoteRole {
+	if n := len(t.open); n > 0 && quotePairs[t.open[n-1]] == s {
+		t.open = t.open[:n-1]
+		return quoteClose
+	}
+	if _, ok := quotePairs[s]; ok {
+		t.open = append(t.open, s)
+		return quoteOpen
+	}
+	if quoteClosers[s] {
+		return quoteUnmatched
+	}
+	return quoteNone
+}
+
+//closers return tokens which close open quotes and brackets, innermost first
+func (t *quoteTracker) closers() []string {
+	res := make([]string, len(t.open))
+	for i, o := range t.open {
+		res[len(t.open)-1-i] = quotePairs[o]
+	}
+	return res
+}
+
+//balanceQuotes return words `words` without closing quotes and brackets which were not opened
+//and with closing ones for open quotes and brackets before final terminators. Words are returned as is
+//if typography is disabled.
+func (r *MarkovChain) balanceQuotes(words []Suffix) []Suffix {
+	if !r.typography {
+		return words
+	}
+	var t quoteTracker
+	res := make([]Suffix, 0, len(words))
+	for _, s := range words {
+		if t.add(s.word) != quoteUnmatched {
+			res = append(res, s)
+		}
+	}
+	closers := t.closers()
+	if len(closers) == 0 {
+		return res
+	}
+	// in Russian typography terminator follows closing quote: «Привет».
+	end := len(res)
+	for end > 0 && isSentenceEnd(res[end-1].word) {
+		end--
+	}
+	tail := append(sourceless(closers...), res[end:]...)
+	return append(res[:end], tail...)
+}
+
+//attached return true if punctuation token `s` is written without space before it
+func attached(s string) bool {
+	if isSentenceEnd(s) {
+		return true
+	}
+	switch s {
+	case ",", ";", ":":
+		return true
+	}
+	return false
+}
+
+//joinTypographic join generated words into text without spaces before punctuation and closing quotes
+//and after opening quotes. Repeated punctuation is collapsed to first token like in `joinWords`.
+func joinTypographic(words []string) string {
+	var b strings.Builder
+	var t quoteTracker
+	afterOpen, afterPunct := false, false
+	for _, s := range words {
+		role := t.add(s)
+		isAttached := attached(s) || role == quoteClose || role == quoteUnmatched
+		if attached(s) && afterPunct {
+			continue
+		}
+		if b.Len() > 0 && !isAttached && !afterOpen {
+			b.WriteByte(' ')
+		}
+		b.WriteString(s)
+		afterOpen = role == quoteOpen
+		afterPunct = attached(s)
+	}
+	return b.String()
+}
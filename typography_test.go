@@ -0,0 +1,39 @@
+package xrich
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypography1(t *testing.T) {
+	c := NewMarkovChain()
+	c.SetTypography(true)
+	words, err := c.tokenize("Он сказал: «Да?!» — и ушел... (навсегда)")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Он", "сказал", ":", "«", "Да", "?!", "»", "—", "и", "ушел", "...", "(", "навсегда", ")"}, words)
+	assert.True(t, isSentenceEnd("?!"))
+	assert.True(t, isSentenceEnd("..."))
+	assert.False(t, isSentenceEnd("—"))
+
+	assert.Equal(t, "Он сказал: «Да?!» — и ушел. (навсегда)",
+		joinTypographic([]string{"Он", "сказал", ":", "«", "Да", "?!", "»", "—", "и", "ушел", ".", "(", "навсегда", ")"}))
+	assert.Equal(t, "да?! нет", joinTypographic([]string{"да", "?!", SEP, "нет"}))
+}
+
+func TestTypography2(t *testing.T) {
+	c := NewMarkovChain()
+	c.SetTypography(true)
+	words := c.balanceQuotes(sourceless("»", "a", "«", "(", "b", "»", "c", "."))
+	assert.Equal(t, []string{"a", "«", "(", "b", "c", ")", "»", "."}, suffixWords(words))
+
+	ss := []string{"он сказал « да » .", "сказал « нет"}
+	c.SetGeneratePolicy(testGeneratePolicy{})
+	assert.NoError(t, c.Build(ss))
+	s, err := c.GenerateAnswer("сказал", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "сказал «да»", s)
+	res := c.GenerateAnswerResult("сказал", GenerateOptions{StopAtEnd: true})
+	assert.NoError(t, res.Err)
+	assert.Equal(t, "сказал «да».", res.Text)
+}